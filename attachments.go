@@ -0,0 +1,88 @@
+package hermes
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+)
+
+// Disposition tells mail clients how to present an attachment
+type Disposition string
+
+// DispositionAttachment presents the attachment as a file to download (default)
+const DispositionAttachment Disposition = "attachment"
+
+// DispositionInline displays the attachment within the message, e.g. an image
+// referenced from the HTML body with a cid: URL
+const DispositionInline Disposition = "inline"
+
+// Attachment is a file sent along with the email (invoice, report and so on)
+type Attachment struct {
+	Name        string      // File name, e.g. invoice.pdf
+	ContentType string      // Content type of the file (default guessed from Name, then from the content)
+	Data        []byte      // Content of the file
+	Reader      io.Reader   // Content of the file when Data is empty, read once when building the message
+	Disposition Disposition // Disposition of the file (default to DispositionAttachment)
+	ContentID   string      // Content-ID of inline files, referenced from the HTML body as cid:<ContentID>
+}
+
+// IsInline tells whether the attachment is displayed within the message
+// rather than presented as a file
+func (a Attachment) IsInline() bool {
+	return a.Disposition == DispositionInline
+}
+
+// filePart is a file added to a message, either an attachment or an embedded image
+type filePart struct {
+	name        string
+	contentType string
+	contentID   string
+	disposition Disposition
+	data        []byte
+}
+
+// attachmentParts reads the content of the attachments, returning the inline
+// ones referenced by a Content-ID apart from the others
+func attachmentParts(attachments []Attachment) (related, attached []filePart, err error) {
+	for _, a := range attachments {
+		if a.Name == "" {
+			return nil, nil, ErrUnnamedAttachment
+		}
+		data := a.Data
+		if len(data) == 0 && a.Reader != nil {
+			data, err = io.ReadAll(a.Reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading attachment %q: %w", a.Name, err)
+			}
+		}
+		p := filePart{
+			name:        a.Name,
+			contentType: a.ContentType,
+			contentID:   a.ContentID,
+			disposition: a.Disposition,
+			data:        data,
+		}
+		if p.contentType == "" {
+			p.contentType = fileContentType(a.Name, data)
+		}
+		if p.disposition == "" {
+			p.disposition = DispositionAttachment
+		}
+		if p.disposition == DispositionInline && p.contentID != "" {
+			related = append(related, p)
+		} else {
+			attached = append(attached, p)
+		}
+	}
+	return related, attached, nil
+}
+
+// fileContentType guesses the content type of a file from its name, then from its content
+func fileContentType(name string, data []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,47 @@
+package hermes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListAttachments(t *testing.T) {
+	email := Email{
+		Body: Body{Name: "Jon Snow"},
+		Attachments: []Attachment{
+			{Name: "invoice.pdf", Data: []byte("invoice")},
+			{Name: "logo.png", Data: []byte("logo"), Disposition: DispositionInline, ContentID: "logo"},
+			{Name: "report.csv", Data: []byte("report")},
+		},
+	}
+
+	for i, theme := range testedThemes {
+		t.Run(fmt.Sprintf("%s-%d", theme.Name(), i), func(t *testing.T) {
+			h := Hermes{Theme: theme, ListAttachments: true}
+			html, err := h.GenerateHTML(email)
+			assert.NoError(t, err)
+			assert.Contains(t, html, "Attached: invoice.pdf, report.csv")
+			assert.NotContains(t, html, "logo.png")
+
+			text, err := h.GeneratePlainText(email)
+			assert.NoError(t, err)
+			assert.Contains(t, text, "Attached: invoice.pdf, report.csv")
+
+			h = Hermes{Theme: theme, ListAttachments: true, Product: Product{AttachmentsText: "Pièces jointes :"}}
+			text, err = h.GeneratePlainText(email)
+			assert.NoError(t, err)
+			assert.Contains(t, text, "Pièces jointes : invoice.pdf, report.csv")
+
+			// Not listed unless asked for
+			h = Hermes{Theme: theme}
+			html, err = h.GenerateHTML(email)
+			assert.NoError(t, err)
+			assert.NotContains(t, html, "invoice.pdf")
+			text, err = h.GeneratePlainText(email)
+			assert.NoError(t, err)
+			assert.NotContains(t, text, "invoice.pdf")
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package hermes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Block is a content block of an email, see Body.Blocks. The templates
+// render each block according to its type.
+type Block interface {
+	// BlockType returns the type of the block, e.g. "paragraph"
+	BlockType() string
+}
+
+// Blocks is an ordered list of content blocks. In JSON, each block is an
+// object with a "type" member holding its type, along with its fields, e.g.
+// {"type": "paragraph", "text": "Welcome!"}.
+type Blocks []Block
+
+// ParagraphBlock is a paragraph of text
+type ParagraphBlock struct {
+	Text       string        // Text of the paragraph
+	TextUnsafe template.HTML // Optional unsafe HTML that replaces Text when set
+}
+
+// MarkdownBlock is markdown content
+type MarkdownBlock struct {
+	Markdown Markdown
+}
+
+// DictionaryBlock is a list of key+value entries
+type DictionaryBlock struct {
+	Entries []Entry
+}
+
+// TableBlock is a table of data
+type TableBlock struct {
+	Table
+}
+
+// ActionBlock is an action, e.g. a button, which link is also listed at the
+// bottom of the email for the clients not displaying buttons
+type ActionBlock struct {
+	Action
+}
+
+// DividerBlock is a horizontal line separating the blocks around it
+type DividerBlock struct{}
+
+// ImageBlock is an image, e.g. a hero banner. In plain text, it is rendered
+// as [Alt](Link).
+type ImageBlock struct {
+	Src     string // URL of the image, or the file name of the image among Data or Hermes.Images
+	Alt     string // Alternative text of the image
+	Width   int    // Width of the image, in pixels (recommended, Outlook displaying images at their natural size)
+	Height  int    // Optional height of the image, in pixels
+	Link    string // Optional URL opened when clicking the image
+	Align   string // Alignment of the image: left, center or right (default to center)
+	Caption string // Optional caption displayed below the image
+	// Data is the content of the image, embedded in built messages as an
+	// inline part referenced with a cid: URL, Src being its file name
+	Data []byte
+}
+
+// ColumnsBlock is a row of columns, e.g. of cards, stacked on mobile. Two or
+// three columns fit the width of emails.
+type ColumnsBlock struct {
+	Columns []Blocks // Blocks of each column
+}
+
+// CardBlock is a card, e.g. a product with an image, a title, a text and a
+// button, usually laid out in columns
+type CardBlock struct {
+	Image  ImageBlock // Optional image displayed at the top of the card
+	Title  string     // Optional title of the card
+	Text   string     // Optional text of the card
+	Button Button     // Optional button of the card
+}
+
+// AlertLevel is the severity of an alert
+type AlertLevel string
+
+// The severities of alerts
+const (
+	AlertInfo    AlertLevel = "info"
+	AlertSuccess AlertLevel = "success"
+	AlertWarning AlertLevel = "warning"
+	AlertDanger  AlertLevel = "danger"
+)
+
+// AlertBlock is a box calling attention to a notice, e.g. a security or
+// billing notice, styled according to its level. In plain text, it is
+// prefixed with its level, e.g. "WARNING:".
+type AlertBlock struct {
+	Level AlertLevel // Severity of the alert (default to AlertInfo, as unknown levels)
+	Title string     // Optional title of the alert
+	Text  string     // Text of the alert
+}
+
+// SpacerBlock is a vertical space between the blocks around it
+type SpacerBlock struct {
+	Height int // Height of the space, in pixels (default to 20)
+}
+
+// BlockType returns "paragraph"
+func (ParagraphBlock) BlockType() string { return "paragraph" }
+
+// BlockType returns "markdown"
+func (MarkdownBlock) BlockType() string { return "markdown" }
+
+// BlockType returns "dictionary"
+func (DictionaryBlock) BlockType() string { return "dictionary" }
+
+// BlockType returns "table"
+func (TableBlock) BlockType() string { return "table" }
+
+// BlockType returns "action"
+func (ActionBlock) BlockType() string { return "action" }
+
+// BlockType returns "divider"
+func (DividerBlock) BlockType() string { return "divider" }
+
+// BlockType returns "image"
+func (ImageBlock) BlockType() string { return "image" }
+
+// BlockType returns "columns"
+func (ColumnsBlock) BlockType() string { return "columns" }
+
+// BlockType returns "card"
+func (CardBlock) BlockType() string { return "card" }
+
+// BlockType returns "alert"
+func (AlertBlock) BlockType() string { return "alert" }
+
+// BlockType returns "spacer"
+func (SpacerBlock) BlockType() string { return "spacer" }
+
+// blockTypes are the blocks which can be decoded from JSON, by type
+var blockTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, b := range []Block{
+		ParagraphBlock{},
+		MarkdownBlock{},
+		DictionaryBlock{},
+		TableBlock{},
+		ActionBlock{},
+		DividerBlock{},
+		ImageBlock{},
+		ColumnsBlock{},
+		CardBlock{},
+		AlertBlock{},
+		SpacerBlock{},
+	} {
+		blockTypes[b.BlockType()] = reflect.TypeOf(b)
+	}
+}
+
+// UnmarshalJSON decodes the blocks of data, according to their "type" member.
+// The members which are not fields of their block are rejected.
+func (b *Blocks) UnmarshalJSON(data []byte) error {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	blocks := make(Blocks, len(raw))
+	for i, fields := range raw {
+		var name string
+		if t, ok := fields["type"]; ok {
+			if err := json.Unmarshal(t, &name); err != nil {
+				return fmt.Errorf("block %d: %w", i, err)
+			}
+			delete(fields, "type")
+		}
+		typ, ok := blockTypes[name]
+		if !ok {
+			return fmt.Errorf("block %d: unknown block type: %q, expecting one of %s", i, name, strings.Join(slices.Sorted(maps.Keys(blockTypes)), ", "))
+		}
+		r, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		v := reflect.New(typ)
+		dec := json.NewDecoder(bytes.NewReader(r))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v.Interface()); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+		blocks[i] = v.Elem().Interface().(Block)
+	}
+	*b = blocks
+	return nil
+}
+
+// MarshalJSON encodes the blocks with their "type" member
+func (b Blocks) MarshalJSON() ([]byte, error) {
+	raw := make([]json.RawMessage, len(b))
+	for i, block := range b {
+		data, err := json.Marshal(block)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			fields = map[string]json.RawMessage{}
+		}
+		fields["type"], _ = json.Marshal(block.BlockType())
+		if raw[i], err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(raw)
+}
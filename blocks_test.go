@@ -0,0 +1,268 @@
+package hermes
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var blocksEmail = Email{
+	Body: Body{
+		Name:   "Jon Snow",
+		Intros: []string{"Your order has been shipped."},
+		Blocks: Blocks{
+			ActionBlock{Action: Action{
+				Instructions: "Follow your parcel:",
+				Button:       Button{Text: "Track your order", Link: "https://hermes-example.com/track"},
+			}},
+			TableBlock{Table: Table{Title: "Your order", Data: [][]Entry{{{Key: "Item", Value: "Golang"}, {Key: "Price", Value: "$10.99"}}}}},
+			DividerBlock{},
+			ParagraphBlock{Text: "Thanks for your order!"},
+			MarkdownBlock{Markdown: "See the **FAQ**"},
+			DictionaryBlock{Entries: []Entry{{Key: "Carrier", Value: "Gopher Express"}}},
+			ImageBlock{Src: "https://hermes-example.com/map.png", Alt: "Delivery map", Width: 300},
+			SpacerBlock{Height: 40},
+		},
+		Outros: []string{"Need help? Just reply to this email."},
+	},
+}
+
+func TestBlocks_JSON(t *testing.T) {
+	data, err := json.Marshal(blocksEmail.Body.Blocks)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(data), `{"Height":40,"type":"spacer"}`)
+	assert.Contains(t, string(data), `{"type":"divider"}`)
+
+	var blocks Blocks
+	if assert.NoError(t, json.Unmarshal(data, &blocks)) {
+		assert.Equal(t, blocksEmail.Body.Blocks, blocks)
+	}
+
+	err = json.Unmarshal([]byte(`[{"type": "paragraph", "text": "Hi"}, {"text": "Hi"}]`), &blocks)
+	assert.EqualError(t, err, `block 1: unknown block type: "", expecting one of action, alert, card, columns, dictionary, divider, image, markdown, paragraph, spacer, table`)
+
+	err = json.Unmarshal([]byte(`[{"type": "columns", "columns": [[{"type": "image", "source": "a.png"}]]}]`), &blocks)
+	assert.EqualError(t, err, `block 0: block 0: json: unknown field "source"`, "Unknown fields should be rejected in nested blocks too")
+}
+
+func TestRender_Blocks(t *testing.T) {
+	for _, theme := range []Theme{new(Default), new(Flat)} {
+		t.Run(theme.Name(), func(t *testing.T) {
+			r, err := New(Hermes{Theme: theme, Product: Product{Name: "Hermes", Link: "https://example-hermes.com/"}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := r.Render(context.Background(), blocksEmail)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// Blocks are rendered in order, between the intros and the outros
+			assertInOrder(t, res.HTML,
+				"Your order has been shipped.",
+				"Follow your parcel:",
+				`class="button"`,
+				`class="data-table-title"`,
+				`class="body-divider"`,
+				"Thanks for your order!",
+				"<strong>FAQ</strong>",
+				"Gopher Express",
+				`<img src="https://hermes-example.com/map.png" alt="Delivery map" width="300"`,
+				`<td height="40"`,
+				"Need help? Just reply to this email.",
+				"https://hermes-example.com/track</a>",
+			)
+			assertInOrder(t, res.Text,
+				"Your order has been shipped.",
+				"Follow your parcel: https://hermes-example.com/track",
+				"|  ITEM  | PRICE  |",
+				"------------",
+				"Thanks for your order!",
+				"See the *FAQ*",
+				"Carrier: Gopher Express",
+				"[Delivery map]",
+				"Need help? Just reply to this email.",
+			)
+		})
+	}
+}
+
+func TestRender_EmptyTableBlock(t *testing.T) {
+	var blocks Blocks
+	if !assert.NoError(t, json.Unmarshal([]byte(`[{"type": "table"}]`), &blocks)) {
+		return
+	}
+	r, err := New(Hermes{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, email := range []Email{
+		{Body: Body{Blocks: Blocks{TableBlock{}}}},
+		{Body: Body{Blocks: blocks}},
+		{Body: Body{Tables: []Table{{}}}},
+	} {
+		res, err := r.Render(context.Background(), email)
+		if assert.NoError(t, err) {
+			assert.NotContains(t, res.HTML, `class="data-table`, "Empty tables should not be rendered")
+			assert.NotContains(t, res.Text, "|")
+		}
+	}
+}
+
+// assertInOrder asserts that s contains parts, in order
+func assertInOrder(t *testing.T, s string, parts ...string) {
+	t.Helper()
+	rest := s
+	for _, part := range parts {
+		_, after, ok := strings.Cut(rest, part)
+		if !assert.True(t, ok, "%q should be rendered after the previous parts", part) {
+			return
+		}
+		rest = after
+	}
+}
+
+func TestRender_ImageBlock(t *testing.T) {
+	r, err := New(Hermes{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	res, err := r.Render(context.Background(), Email{Body: Body{Blocks: Blocks{
+		ImageBlock{Src: "https://example.com/banner.png", Alt: "Summer sale", Width: 500, Height: 200, Link: "https://example.com/sale", Caption: "Until Sunday"},
+		ImageBlock{Src: "https://example.com/logo.png", Align: "right"},
+	}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assertInOrder(t, res.HTML,
+		`<td align="center"`,
+		`<a href="https://example.com/sale" target="_blank"`,
+		`<img src="https://example.com/banner.png" alt="Summer sale" width="500" height="200" border="0" style="display: block; border: 0; outline: none; text-decoration: none; height: auto; max-width: 100%; margin: 0 auto;"`,
+		`</a>`,
+		`Until Sunday</p>`,
+		`<td align="right"`,
+		`<img src="https://example.com/logo.png" alt="" border="0" style="display: block; border: 0; outline: none; text-decoration: none; height: auto; max-width: 100%; margin-left: auto;"`,
+	)
+	assertInOrder(t, res.Text, "[Summer sale](https://example.com/sale)", "Until Sunday")
+}
+
+func TestRender_ColumnsBlock(t *testing.T) {
+	r, err := New(Hermes{Theme: new(Flat)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	card := func(name string) Blocks {
+		return Blocks{CardBlock{
+			Image:  ImageBlock{Src: "https://example.com/" + name + ".png", Alt: name, Width: 220},
+			Title:  name,
+			Text:   "The best " + name,
+			Button: Button{Text: "Buy " + name, Link: "https://example.com/" + name},
+		}}
+	}
+	email := Email{Body: Body{Blocks: Blocks{ColumnsBlock{Columns: []Blocks{card("Gopher"), card("Mascot")}}}}}
+	res, err := r.Render(context.Background(), email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assertInOrder(t, res.HTML,
+		`<!--[if mso]><table role="presentation" width="100%" cellpadding="0" cellspacing="0"><tr><![endif]-->`,
+		`<!--[if mso]><td width="250" valign="top"><![endif]-->`,
+		`<div class="body-column" style="display: inline-block; width: 100%; max-width: 250px; vertical-align: top;"`,
+		`<img src="https://example.com/Gopher.png" alt="Gopher" width="220"`,
+		`>Gopher</h3>`,
+		"The best Gopher",
+		`<table class="body-card_action" cellpadding="0" cellspacing="0" role="presentation" style="width:auto;`,
+		`bgcolor="#00948d"`,
+		`<a href="https://example.com/Gopher" target="_blank"`,
+		`<!--[if mso]></td><![endif]-->`,
+		`<!--[if mso]><td width="250" valign="top"><![endif]-->`,
+		`>Mascot</h3>`,
+		`<!--[if mso]></tr></table><![endif]-->`,
+	)
+	// Columns share the width of the content, which depends on the spacing
+	spaced, err := ExtendTheme(new(Flat), ThemeExtension{Name: "spaced", Tokens: Tokens{Spacing: 4}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r, err = New(Hermes{Theme: spaced})
+	if !assert.NoError(t, err) {
+		return
+	}
+	spacedRes, err := r.Render(context.Background(), email)
+	if assert.NoError(t, err) {
+		assert.Contains(t, spacedRes.HTML, `<!--[if mso]><td width="257" valign="top"><![endif]-->`)
+		assert.Contains(t, spacedRes.HTML, `max-width: 257px;`)
+	}
+
+	// Columns are stacked on mobile
+	assertInOrder(t, res.HTML, "@media only screen and (max-width: 500px)", ".body-column {", "max-width: 100% !important")
+	assertInOrder(t, res.Text,
+		"[Gopher]", "Gopher\n------", "The best Gopher", "Buy Gopher: https://example.com/Gopher",
+		"[Mascot]", "Mascot\n------", "The best Mascot", "Buy Mascot: https://example.com/Mascot",
+	)
+}
+
+func TestRender_AlertBlock(t *testing.T) {
+	theme, err := ExtendTheme(new(Default), ThemeExtension{Name: "brand", Tokens: Tokens{Primary: "#ff6600"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	email := Email{Body: Body{Blocks: Blocks{
+		AlertBlock{Title: "New sign-in", Text: "Your account was accessed from a new device."},
+		AlertBlock{Level: AlertDanger, Text: "Your payment failed."},
+		AlertBlock{Level: "critical", Text: "Unknown levels are info ones."},
+	}}}
+	for _, dir := range []TextDirection{TDLeftToRight, TDRightToLeft} {
+		t.Run(string(dir), func(t *testing.T) {
+			r, err := New(Hermes{Theme: theme, TextDirection: dir})
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := r.Render(context.Background(), email)
+			if !assert.NoError(t, err) {
+				return
+			}
+			// The border is on the side the text starts from
+			style := "width:100%;margin:20px 0;border-left-width:4px;border-left-style:solid;border-radius:3px;border-color:#ff6600;background-color:#fff3eb"
+			if dir == TDRightToLeft {
+				style = "width:100%;margin:20px 0;border-left-style:solid;border-radius:3px;border-color:#ff6600;background-color:#fff3eb;border-left-width:0;border-right-width:4px;border-right-style:solid"
+			}
+			assertInOrder(t, res.HTML,
+				`<table class="body-alert body-alert--info" width="100%" cellpadding="0" cellspacing="0" role="presentation" style="`+style+`"`,
+				`New sign-in</p>`,
+				"Your account was accessed from a new device.</p>",
+				`<table class="body-alert body-alert--danger"`,
+				"border-color:#dc4d2f;background-color:#fcecea",
+				"Your payment failed.</p>",
+				`<table class="body-alert body-alert--info"`,
+				"Unknown levels are info ones.</p>",
+			)
+			assertInOrder(t, res.Text,
+				"INFO: New sign-in", "Your account was accessed from a new device.",
+				"DANGER: Your payment failed.",
+				"INFO: Unknown levels are info ones.",
+			)
+		})
+	}
+}
+
+func TestBlockImages(t *testing.T) {
+	images := blockImages(Blocks{
+		ImageBlock{Src: "banner.png", Data: []byte("banner")},
+		ImageBlock{Src: "https://example.com/remote.png", Data: []byte("remote")},
+		ColumnsBlock{Columns: []Blocks{{CardBlock{Image: ImageBlock{Src: "/cards/gopher.png", Data: []byte("gopher")}}}}},
+	})
+	assert.Equal(t, ImageMap{"banner.png": []byte("banner"), "cards/gopher.png": []byte("gopher")}, images)
+
+	images = blockImages(Blocks{
+		&ImageBlock{Src: "banner.png", Data: []byte("banner")},
+		&ColumnsBlock{Columns: []Blocks{{&CardBlock{Image: ImageBlock{Src: "gopher.png", Data: []byte("gopher")}}}}},
+		(*ImageBlock)(nil),
+	})
+	assert.Equal(t, ImageMap{"banner.png": []byte("banner"), "gopher.png": []byte("gopher")}, images, "Pointer blocks should be walked too")
+}
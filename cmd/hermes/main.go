@@ -0,0 +1,71 @@
+// Command hermes renders and previews hermes emails described in JSON or YAML
+// files, without writing Go.
+//
+// Usage:
+//
+//	hermes render [flags] spec.yaml...
+//	hermes preview [flags] spec.yaml...
+//	hermes themes [flags]
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errUsage is returned by commands when their flags are invalid, once the
+// flag package printed the usage
+var errUsage = errors.New("invalid usage")
+
+// command is a subcommand of hermes
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"render", "render emails to .html and .txt files", runRender},
+	{"preview", "serve a live-reloading gallery of emails", runPreview},
+	{"themes", "list the available themes", runThemes},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the subcommand named by args[0] and returns the exit status
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		if err := cmd.run(args[1:], stdout, stderr); err != nil {
+			if err != errUsage {
+				_, _ = fmt.Fprintf(stderr, "hermes %s: %v\n", cmd.name, err)
+			}
+			return 1
+		}
+		return 0
+	}
+	_, _ = fmt.Fprintf(stderr, "hermes: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: hermes <command> [flags] [arguments]")
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, `Run "hermes <command> -h" for the flags of a command.`)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/go-hermes/hermes/v2/preview"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "render")
+
+	stderr.Reset()
+	assert.Equal(t, 2, run([]string{"unknown"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `unknown command "unknown"`)
+
+	stderr.Reset()
+	assert.Equal(t, 1, run([]string{"render"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: hermes render")
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	jsonSpec := filepath.Join(dir, "receipt.json")
+	err := os.WriteFile(jsonSpec, []byte(`{
+		"theme": "flat",
+		"hermes": {"product": {"name": "Hermes", "link": "https://example-hermes.com/"}, "textDirection": "rtl"},
+		"email": {"body": {"name": "Jon Snow", "intros": ["Your order has been processed successfully."], "blocks": [
+			{"type": "action", "button": {"text": "Track your order", "link": "https://hermes-example.com/track"}},
+			{"type": "divider"},
+			{"type": "table", "data": [[{"key": "Item", "value": "Golang"}]]}
+		]}}
+	}`), 0644)
+	assert.NoError(t, err)
+
+	var stdout, stderr bytes.Buffer
+	out := filepath.Join(dir, "out")
+	status := run([]string{"render", "-o", out, "../../examples/specs/welcome.yaml", jsonSpec}, &stdout, &stderr)
+	if !assert.Equal(t, 0, status, stderr.String()) {
+		return
+	}
+	assert.Contains(t, stdout.String(), filepath.Join(out, "welcome.html"))
+
+	tests := []struct {
+		name   string
+		hermes hermes.Hermes
+		email  hermes.Email
+	}{
+		{
+			name: "welcome",
+			hermes: hermes.Hermes{
+				Theme: new(hermes.Default),
+				Product: hermes.Product{
+					Name: "Hermes",
+					Link: "https://example-hermes.com/",
+					Logo: "https://github.com/matcornic/hermes/blob/master/examples/gopher.png?raw=true",
+				},
+			},
+			email: hermes.Email{Body: hermes.Body{
+				Name:       "Jon Snow",
+				Intros:     []string{"Welcome to Hermes! We're very excited to have you on board."},
+				Dictionary: []hermes.Entry{{Key: "Firstname", Value: "Jon"}, {Key: "Lastname", Value: "Snow"}, {Key: "Birthday", Value: "01/01/283"}},
+				Actions: []hermes.Action{{
+					Instructions: "To get started with Hermes, please click here:",
+					Button:       hermes.Button{Text: "Confirm your account", Link: "https://hermes-example.com/confirm?token=d9729feb74992cc3482b350163a1a010"},
+				}},
+				Outros: []string{"Need help, or have questions? Just reply to this email, we'd love to help."},
+			}},
+		},
+		{
+			name: "receipt",
+			hermes: hermes.Hermes{
+				Theme:         new(hermes.Flat),
+				TextDirection: hermes.TDRightToLeft,
+				Product:       hermes.Product{Name: "Hermes", Link: "https://example-hermes.com/"},
+			},
+			email: hermes.Email{Body: hermes.Body{Name: "Jon Snow", Intros: []string{"Your order has been processed successfully."}, Blocks: hermes.Blocks{
+				hermes.ActionBlock{Action: hermes.Action{Button: hermes.Button{Text: "Track your order", Link: "https://hermes-example.com/track"}}},
+				hermes.DividerBlock{},
+				hermes.TableBlock{Table: hermes.Table{Data: [][]hermes.Entry{{{Key: "Item", Value: "Golang"}}}}},
+			}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := hermes.New(test.hermes)
+			assert.NoError(t, err)
+			want, err := r.Render(context.Background(), test.email)
+			assert.NoError(t, err)
+
+			html, err := os.ReadFile(filepath.Join(out, test.name+".html"))
+			assert.NoError(t, err)
+			assert.Equal(t, want.HTML, string(html))
+			text, err := os.ReadFile(filepath.Join(out, test.name+".txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, want.Text, string(text))
+		})
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"missing file", []string{filepath.Join(dir, "missing.json")}, "no such file"},
+		{"unsupported format", []string{write("email.toml", "")}, "unsupported spec format"},
+		{"unknown field", []string{write("unknown.json", `{"email": {"bdy": {}}}`)}, `unknown field "bdy"`},
+		{"unknown block", []string{write("block.json", `{"email": {"body": {"blocks": [{"type": "video"}]}}}`)}, `block 0: unknown block type: "video"`},
+		{"unknown block field", []string{write("field.json", `{"email": {"body": {"blocks": [{"type": "paragraph", "txt": "oops"}]}}}`)}, `block 0: json: unknown field "txt"`},
+		{"invalid yaml", []string{write("invalid.yaml", "email: [")}, "invalid.yaml"},
+		{"unknown theme", []string{write("theme.yaml", "theme: fancy")}, `unknown theme: "fancy", expecting one of default, flat`},
+		{"theme flag", []string{"-theme", "fancy", write("flag.yaml", "theme: flat")}, `unknown theme: "fancy"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"render", "-o", filepath.Join(dir, "out")}, test.args...)
+			assert.Equal(t, 1, run(args, &stdout, &stderr))
+			assert.Contains(t, stderr.String(), test.err)
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"preview"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: hermes preview")
+
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "welcome.yaml")
+	assert.NoError(t, os.WriteFile(spec, []byte("email:\n  body:\n    intros: [First version]\n"), 0644))
+	themeDir := writeTheme(t, "corporate")
+	cfg := previewConfig([]string{spec}, []string{themeDir}, []string{"templates"})
+	assert.Equal(t, []string{"templates", themeDir, spec}, cfg.Watch)
+
+	handler := preview.NewHandler(cfg)
+	get := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/render?name=welcome&theme=flat&format=text", nil))
+		return w.Body.String()
+	}
+	assert.Contains(t, get(), "First version")
+	assert.NoError(t, os.WriteFile(spec, []byte("email:\n  body:\n    intros: [Second version]\n"), 0644))
+	assert.Contains(t, get(), "Second version", "Specs should be read again for each page")
+
+	g, err := cfg.Load()
+	assert.NoError(t, err)
+	if assert.Len(t, g.Themes, 3) {
+		assert.Equal(t, "corporate", g.Themes[2].Name())
+	}
+}
+
+// writeTheme writes a theme directory with the templates of the default theme
+func writeTheme(t *testing.T, name string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.Mkdir(dir, 0750))
+	for src, dst := range map[string]string{
+		"default.tpl.html": hermes.ThemeHTMLFile,
+		"default.tpl.txt":  hermes.ThemePlainTextFile,
+		"default.css":      hermes.ThemeCSSFile,
+	} {
+		data, err := os.ReadFile(filepath.Join("../../templates", src))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, dst), data, 0644))
+	}
+	return dir
+}
+
+func TestRender_ThemeDir(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "welcome.yaml")
+	assert.NoError(t, os.WriteFile(spec, []byte("theme: corporate\nemail:\n  body:\n    name: Jon Snow\n"), 0644))
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"render", "-o", dir, "-theme-dir", writeTheme(t, "corporate"), spec}, &stdout, &stderr)
+	if !assert.Equal(t, 0, status, stderr.String()) {
+		return
+	}
+	html, err := os.ReadFile(filepath.Join(dir, "welcome.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `class="theme-corporate"`)
+
+	stderr.Reset()
+	status = run([]string{"render", "-o", dir, "-theme-dir", filepath.Join(dir, "missing"), spec}, &stdout, &stderr)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr.String(), "loading theme missing")
+}
+
+func TestThemeByName(t *testing.T) {
+	corporate, err := hermes.ExtendTheme(new(hermes.Default), hermes.ThemeExtension{Name: "corporate"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	for name, want := range map[string]string{"": "default", "Default": "default", "FLAT": "flat", "Corporate": "corporate"} {
+		theme, err := themeByName(name, []hermes.Theme{corporate})
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, want, theme.Name(), "Theme names should be case-insensitive")
+		}
+	}
+	_, err = themeByName("fancy", nil)
+	assert.ErrorIs(t, err, hermes.ErrUnknownTheme)
+}
+
+func TestThemes(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"themes"}, &stdout, &stderr), stderr.String())
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Regexp(t, `^NAME\s+FEATURES\s+DESCRIPTION$`, lines[0])
+		assert.Regexp(t, `^default\s+responsive,rtl\s+Clean`, lines[1])
+		assert.Regexp(t, `^flat\s+`, lines[2])
+	}
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"themes", "-json", "-theme-dir", writeTheme(t, "corporate")}, &stdout, &stderr), stderr.String())
+	var infos []hermes.ThemeInfo
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &infos))
+	if assert.Len(t, infos, 3) {
+		assert.Equal(t, hermes.ThemeInfo{Name: "corporate"}, infos[2])
+	}
+}
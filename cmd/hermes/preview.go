@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-hermes/hermes/v2/preview"
+)
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runPreview serves a gallery of the emails described by spec files,
+// reloaded when the specs or the watched files change
+func runPreview(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("preview", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", "localhost:8080", "address the preview is served on")
+	var watch stringList
+	fs.Var(&watch, "watch", "file or directory reloading the preview when it changes (repeatable)")
+	var themeDirs stringList
+	fs.Var(&themeDirs, "theme-dir", "directory of a theme to add to the gallery, watched for changes (repeatable)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: hermes preview [flags] spec.{json,yaml}...")
+		_, _ = fmt.Fprintln(stderr)
+		_, _ = fmt.Fprintln(stderr, "Serves the emails of the specs, rendered with every theme.")
+		_, _ = fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: preview.NewHandler(previewConfig(fs.Args(), themeDirs, watch))}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	_, _ = fmt.Fprintf(stdout, "Serving preview on http://%s/\n", ln.Addr())
+	if err = server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// previewConfig returns the configuration of a preview reading the specs and
+// themes again for each page, and watching them along with the given paths
+func previewConfig(specs, themeDirs, watch []string) preview.Config {
+	return preview.Config{
+		Load: func() (preview.Gallery, error) {
+			loaded, err := loadThemes(themeDirs)
+			if err != nil {
+				return preview.Gallery{}, err
+			}
+			g := preview.Gallery{Themes: slices.Concat(registeredThemes(), loaded)}
+			for _, name := range specs {
+				s, err := readSpec(name)
+				if err != nil {
+					return g, err
+				}
+				g.Emails = append(g.Emails, preview.Email{
+					Name:   strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)),
+					Hermes: s.Hermes,
+					Email:  s.Email,
+				})
+			}
+			return g, nil
+		},
+		Watch: slices.Concat(watch, themeDirs, specs),
+	}
+}
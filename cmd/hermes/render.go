@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+// runRender renders the emails described by spec files to .html and .txt files
+func runRender(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	out := fs.String("o", ".", "directory where the files are written")
+	theme := fs.String("theme", "", "name of the theme of the emails, overriding the theme of the specs")
+	var themeDirs stringList
+	fs.Var(&themeDirs, "theme-dir", "directory of a theme to load, selected by its name (repeatable)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: hermes render [flags] spec.{json,yaml}...")
+		_, _ = fmt.Fprintln(stderr)
+		_, _ = fmt.Fprintln(stderr, "Renders each spec to <name>.html and <name>.txt, named after the spec file.")
+		_, _ = fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	loaded, err := loadThemes(themeDirs)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(*out, 0750); err != nil {
+		return err
+	}
+	for _, name := range fs.Args() {
+		s, err := readSpec(name)
+		if err != nil {
+			return err
+		}
+		if *theme != "" {
+			s.Theme = *theme
+		}
+		base := filepath.Join(*out, strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)))
+		warnings, err := renderSpec(s, loaded, base)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, w := range warnings {
+			_, _ = fmt.Fprintf(stderr, "%s: warning: %s\n", name, w)
+		}
+		_, _ = fmt.Fprintf(stdout, "%s.html\n%s.txt\n", base, base)
+	}
+	return nil
+}
+
+// renderSpec renders the email of the spec to base.html and base.txt, and
+// returns the rendering warnings
+func renderSpec(s *spec, loaded []hermes.Theme, base string) ([]string, error) {
+	theme, err := themeByName(s.Theme, loaded)
+	if err != nil {
+		return nil, err
+	}
+	s.Hermes.Theme = theme
+
+	r, err := hermes.New(s.Hermes)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.Render(context.Background(), s.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(base+".html", []byte(res.HTML), 0644); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(base+".txt", []byte(res.Text), 0644); err != nil {
+		return nil, err
+	}
+	return res.Warnings, nil
+}
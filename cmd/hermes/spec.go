@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-hermes/hermes/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// spec describes an email to render. Field names follow the Go fields of
+// hermes.Hermes and hermes.Email, case-insensitively, e.g.:
+//
+//	theme: flat
+//	hermes:
+//	  product:
+//	    name: Hermes
+//	    link: https://example-hermes.com/
+//	email:
+//	  body:
+//	    name: Jon Snow
+//	    intros:
+//	      - Welcome to Hermes!
+type spec struct {
+	Theme  string        `json:"theme"`
+	Hermes hermes.Hermes `json:"hermes"`
+	Email  hermes.Email  `json:"email"`
+}
+
+// readSpec reads the spec of a JSON or YAML file, told apart by their extension
+func readSpec(name string) (*spec, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	case ".json":
+	default:
+		return nil, fmt.Errorf("%s: unsupported spec format, expecting .json, .yaml or .yml", name)
+	}
+
+	s := new(spec)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so that specs are decoded
+// the same way whatever their format
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(v))
+}
+
+// jsonValue converts the maps decoded from YAML, that may have non-string keys, to JSON objects
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// registeredThemes returns the themes registered in hermes
+func registeredThemes() []hermes.Theme {
+	var themes []hermes.Theme
+	for _, info := range hermes.Themes() {
+		if theme, err := hermes.LookupTheme(info.Name); err == nil {
+			themes = append(themes, theme)
+		}
+	}
+	return themes
+}
+
+// loadThemes loads the themes of the directories, named after the directories
+// unless their manifest tells otherwise
+func loadThemes(dirs []string) ([]hermes.Theme, error) {
+	var themes []hermes.Theme
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		theme, err := hermes.LoadTheme(os.DirFS(filepath.Dir(abs)), filepath.Base(abs))
+		if err != nil {
+			return nil, err
+		}
+		themes = append(themes, theme)
+	}
+	return themes, nil
+}
+
+// themeByName returns the theme with the given name, whatever its case,
+// among the loaded and registered themes, default to hermes.Default
+func themeByName(name string, loaded []hermes.Theme) (hermes.Theme, error) {
+	if name == "" {
+		return new(hermes.Default), nil
+	}
+	themes := slices.Concat(loaded, registeredThemes())
+	var names []string
+	for _, t := range themes {
+		if strings.EqualFold(t.Name(), name) {
+			return t, nil
+		}
+		names = append(names, t.Name())
+	}
+	return nil, fmt.Errorf("%w: %q, expecting one of %s", hermes.ErrUnknownTheme, name, strings.Join(names, ", "))
+}
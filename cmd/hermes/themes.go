@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+// runThemes lists the registered themes and the themes of the given directories
+func runThemes(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("themes", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "print the themes as JSON")
+	var themeDirs stringList
+	fs.Var(&themeDirs, "theme-dir", "directory of a theme to list (repeatable)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: hermes themes [flags]")
+		_, _ = fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	loaded, err := loadThemes(themeDirs)
+	if err != nil {
+		return err
+	}
+	infos := hermes.Themes()
+	for _, theme := range loaded {
+		infos = append(infos, hermes.DescribeTheme(theme))
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tFEATURES\tDESCRIPTION")
+	for _, info := range infos {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", info.Name, strings.Join(slices.Sorted(slices.Values(info.Features)), ","), info.Description)
+	}
+	return w.Flush()
+}
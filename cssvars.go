@@ -0,0 +1,210 @@
+package hermes
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// cssVars resolves the CSS custom properties of a document, e.g. var(--brand),
+// which many email clients (Gmail, Outlook desktop) do not support
+type cssVars struct {
+	vars       map[string]string
+	unresolved []string
+}
+
+// resolveCSSVariables replaces the var() references of the <style> elements
+// and style attributes of doc by the values of the custom properties they
+// refer to, or by their fallbacks. Custom properties are taken from the
+// style rules of the document, those of an at-rule, e.g. @media, only
+// applying within it. Only the <style> elements with var() references are
+// rewritten, without their custom properties; the others, e.g. those ignored
+// by the inliner, are left untouched. It returns a warning for each
+// unresolved custom property, left as is.
+func resolveCSSVariables(doc *goquery.Document) []string {
+	styles := doc.Find("style")
+	attrs := doc.Find("[style]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.Contains(s.AttrOr("style", ""), "var(")
+	})
+	if !strings.Contains(styles.Text(), "var(") && attrs.Length() == 0 {
+		return nil
+	}
+
+	sheets := make([]Stylesheet, styles.Length())
+	c := &cssVars{vars: map[string]string{}}
+	styles.Each(func(i int, s *goquery.Selection) {
+		sheets[i] = ParseStylesheet(s.Text())
+		c.define(sheets[i])
+	})
+	for i, n := range styles.Nodes {
+		if !strings.Contains(styles.Eq(i).Text(), "var(") {
+			continue
+		}
+		// Not Selection.SetText, which escapes the text as in any other element
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: Stylesheet(c.resolveRules(sheets[i])).String()})
+	}
+	attrs.Each(func(_ int, s *goquery.Selection) {
+		s.SetAttr("style", c.resolveValue(s.AttrOr("style", "")))
+	})
+
+	warnings := make([]string, len(c.unresolved))
+	for i, name := range c.unresolved {
+		warnings[i] = fmt.Sprintf("CSS variable %s could not be resolved: it is undefined or cyclic, without fallback", name)
+	}
+	return warnings
+}
+
+// resolveStylesVariables replaces the var() references of styles by the
+// values of the custom properties defined in styles, or by their fallbacks.
+// The unresolved references are left for resolveCSSVariables to report.
+func resolveStylesVariables(styles StylesDefinition) {
+	c := &cssVars{vars: map[string]string{}}
+	for _, sel := range slices.Sorted(maps.Keys(styles)) {
+		for property, value := range styles[sel] {
+			if v, ok := value.(string); ok && strings.HasPrefix(property, "--") {
+				c.vars[property] = v
+			}
+		}
+	}
+	if len(c.vars) == 0 {
+		return
+	}
+	for _, props := range styles {
+		for property, value := range props {
+			if v, ok := value.(string); ok && !strings.HasPrefix(property, "--") && strings.Contains(v, "var(") {
+				props[property], _ = c.resolve(v, nil)
+			}
+		}
+	}
+}
+
+// define sets the custom properties of the style rules of rules
+func (c *cssVars) define(rules []Rule) {
+	for _, r := range rules {
+		if r.IsAtRule() {
+			continue
+		}
+		for _, d := range r.Declarations {
+			if strings.HasPrefix(d.Property, "--") {
+				c.vars[d.Property] = d.Value
+			}
+		}
+	}
+}
+
+// resolveRules returns rules with their var() references resolved and
+// without custom properties, the rules left empty being removed
+func (c *cssVars) resolveRules(rules []Rule) []Rule {
+	var out []Rule
+	for _, r := range rules {
+		if r.IsAtRule() && r.Rules != nil {
+			// The custom properties of an at-rule only apply within it
+			scoped := &cssVars{vars: maps.Clone(c.vars), unresolved: c.unresolved}
+			scoped.define(r.Rules)
+			r.Rules = scoped.resolveRules(r.Rules)
+			c.unresolved = scoped.unresolved
+			if len(r.Rules) == 0 && len(r.Declarations) == 0 {
+				continue
+			}
+		}
+		decls := r.Declarations[:0:0]
+		for _, d := range r.Declarations {
+			if strings.HasPrefix(d.Property, "--") {
+				continue
+			}
+			d.Value = c.resolveValue(d.Value)
+			decls = append(decls, d)
+		}
+		if r.Declarations != nil && len(decls) == 0 && len(r.Rules) == 0 {
+			continue
+		}
+		if r.Declarations != nil {
+			r.Declarations = decls
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// resolveValue returns value with its var() references resolved, recording
+// the custom properties left unresolved
+func (c *cssVars) resolveValue(value string) string {
+	value, missing := c.resolve(value, nil)
+	for _, name := range missing {
+		if !slices.Contains(c.unresolved, name) {
+			c.unresolved = append(c.unresolved, name)
+		}
+	}
+	return value
+}
+
+// resolve returns value with its var() references resolved, and the custom
+// properties which could not be, being undefined or cyclic, without fallback.
+// stack holds the custom properties being resolved.
+func (c *cssVars) resolve(value string, stack []string) (string, []string) {
+	var b strings.Builder
+	var missing []string
+	for {
+		start := strings.Index(value, "var(")
+		end := -1
+		if start >= 0 {
+			end = closingParen(value, start+len("var("))
+		}
+		if end < 0 {
+			b.WriteString(value)
+			return b.String(), missing
+		}
+		b.WriteString(value[:start])
+
+		name, fallback, hasFallback := strings.Cut(value[start+len("var("):end], ",")
+		name = strings.TrimSpace(name)
+		resolved, unresolved := "", []string{name}
+		if v, ok := c.vars[name]; ok && !slices.Contains(stack, name) {
+			resolved, unresolved = c.resolve(v, append(stack, name))
+		}
+		if len(unresolved) > 0 && hasFallback {
+			resolved, unresolved = c.resolve(strings.TrimSpace(fallback), stack)
+		}
+		if len(unresolved) > 0 {
+			missing = append(missing, unresolved...)
+			resolved = value[start : end+1]
+		}
+		b.WriteString(resolved)
+		value = value[end+1:]
+	}
+}
+
+// closingParen returns the index of the parenthesis closing the one opened
+// before pos in s, outside of strings, or -1
+func closingParen(s string, pos int) int {
+	depth := 1
+	var quote byte
+	for i := pos; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
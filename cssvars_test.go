@@ -0,0 +1,116 @@
+package hermes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSSVars_Resolve(t *testing.T) {
+	c := &cssVars{vars: map[string]string{
+		"--brand":  "#ff6600",
+		"--border": "1px solid var(--brand)",
+		"--font":   `"Inter", var(--fallback-font, sans-serif)`,
+		"--loop":   "var(--loop)",
+	}}
+	for value, want := range map[string]string{
+		"var(--brand)":                         "#ff6600",
+		"var( --brand ) !important":            "#ff6600 !important",
+		"var(--border)":                        "1px solid #ff6600",
+		"var(--font)":                          `"Inter", sans-serif`,
+		"var(--missing, Arial, sans-serif)":    "Arial, sans-serif",
+		"var(--missing, var(--brand))":         "#ff6600",
+		"0 var(--missing, calc(2px * 3)) 10px": "0 calc(2px * 3) 10px",
+		"var(--undefined)":                     "var(--undefined)",
+		"var(--loop, red)":                     "red",
+		"url(var.png)":                         "url(var.png)",
+	} {
+		assert.Equal(t, want, c.resolveValue(value), value)
+	}
+	assert.Equal(t, []string{"--undefined"}, c.unresolved)
+
+	c.resolveValue("var(--loop)")
+	assert.Equal(t, []string{"--undefined", "--loop"}, c.unresolved)
+}
+
+func TestResolveCSSVariables(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><head>
+<style>:root { --brand: #ff6600; --radius: 4px; }
+a { color: var(--brand); }
+@media (prefers-color-scheme: dark) { :root { --brand: #33cccc; } a { color: var(--brand) !important; } }
+.button { border-radius: var(--radius); background: var(--unknown); }</style>
+<style>p { color: #333333; }</style>
+<style data-premailer="ignore">:root { --dark: #33cccc; }</style>
+</head><body><p style="border-color: var(--brand, red)">Hi</p></body></html>`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	warnings := resolveCSSVariables(doc)
+	assert.Equal(t, []string{"CSS variable --unknown could not be resolved: it is undefined or cyclic, without fallback"}, warnings)
+	assert.Equal(t, `a {
+  color: #ff6600;
+}
+
+@media (prefers-color-scheme: dark) {
+  a {
+    color: #33cccc !important;
+  }
+}
+
+.button {
+  border-radius: 4px;
+  background: var(--unknown);
+}
+`, doc.Find("style").First().Text(), "Custom properties should be resolved in their scope and removed")
+	assert.Equal(t, "border-color: #ff6600", doc.Find("p").AttrOr("style", ""))
+	assert.Equal(t, "p { color: #333333; }", doc.Find("style").Eq(1).Text(), "Styles without var() references should be left untouched")
+	assert.Equal(t, ":root { --dark: #33cccc; }", doc.Find("style").Eq(2).Text())
+
+	// Documents without var() references are left untouched
+	doc, _ = goquery.NewDocumentFromReader(strings.NewReader(`<style>:root { --brand: #ff6600; }</style>`))
+	assert.Empty(t, resolveCSSVariables(doc))
+	assert.Equal(t, ":root { --brand: #ff6600; }", doc.Find("style").Text())
+}
+
+func TestRender_CSSVariables(t *testing.T) {
+	theme, err := ExtendTheme(new(Default), ThemeExtension{Name: "vars", Styles: StylesDefinition{
+		":root":   {"--brand": "#ff6600"},
+		".button": {"background-color": "var(--brand)"},
+	}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r, err := New(Hermes{Theme: theme})
+	if !assert.NoError(t, err) {
+		return
+	}
+	email := extendEmail
+	email.Body.TemplateOverrides = map[string]any{"additional_styles": "h1 { color: var(--brand); } p { color: var(--text); }"}
+	res, err := r.Render(context.Background(), email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, res.HTML, `class="button" style="-webkit-text-size-adjust:none;display:inline-block;background-color:#ff6600`)
+	assert.Contains(t, res.HTML, `strokecolor="#ff6600" fillcolor="#ff6600"`)
+	assert.NotContains(t, res.HTML, "var(--brand)")
+	assert.NotContains(t, res.HTML, "--brand:")
+	assert.Equal(t, []string{"CSS variable --text could not be resolved: it is undefined or cyclic, without fallback"}, res.Warnings)
+
+	// Without inlining, the output is streamed: only the styles of the theme and of the email are resolved
+	r, err = New(Hermes{Theme: theme, DisableCSSInlining: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	res, err = r.Render(context.Background(), email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, res.HTML, "background-color: #ff6600;")
+	assert.Contains(t, res.HTML, `strokecolor="#ff6600" fillcolor="#ff6600"`)
+	assert.Contains(t, res.HTML, "h1 { color: var(--brand); }", "additional_styles should be written as they are")
+	assert.Empty(t, res.Warnings)
+}
@@ -8,6 +8,7 @@ import (
 var (
 	parsedDefaultHTML      = template.Must(TemplateBase().Parse(Default{}.HTMLTemplate()))
 	parsedDefaultPlainText = template.Must(TemplateBase().Parse(Default{}.PlainTextTemplate()))
+	defaultStylesheet      = ParseStylesheet(getTemplate("templates/default.css"))
 )
 
 // Default is the theme by default
@@ -18,10 +19,43 @@ func (dt Default) Name() string {
 	return "default"
 }
 
+// Info describes the default theme
+func (dt Default) Info() ThemeInfo {
+	return ThemeInfo{
+		Name:        dt.Name(),
+		Description: "Clean and responsive theme, with a light background",
+		Features:    []string{"responsive", "rtl"},
+	}
+}
+
+// Tokens returns the design tokens of the default theme
+func (dt Default) Tokens() Tokens {
+	return Tokens{
+		Primary:    "#3869d4",
+		Accent:     "#2f3133",
+		Background: "#f2f4f6",
+		Text:       "#74787e",
+		FontFamily: `Arial, "Helvetica Neue", Helvetica, sans-serif`,
+		Radius:     "3px",
+		Spacing:    5,
+		Dark: DarkPalette{
+			Accent:     "#f5f5f5",
+			Background: "#111111",
+			Surface:    "#1e1e1e",
+			Text:       "#d4d4d4",
+		},
+	}
+}
+
 func (dt Default) Styles() StylesDefinition {
 	return GetDefaultStyles()
 }
 
+// Stylesheet returns the styles of the default theme, in the order of default.css
+func (dt Default) Stylesheet() Stylesheet {
+	return defaultStylesheet.clone()
+}
+
 // HTMLTemplate returns a Golang template that will generate an HTML email.
 func (dt Default) HTMLTemplate() string {
 	return getTemplate(fmt.Sprintf(htmlEmail, dt.Name()))
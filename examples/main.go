@@ -1,25 +1,19 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	netmail "net/mail"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/go-hermes/hermes/v2"
+	"github.com/go-hermes/hermes/v2/transport"
 	"github.com/wneessen/go-mail"
 	"golang.org/x/term"
 )
 
-var (
-	errEmptyServerConfig   = errors.New("SMTP server config is empty")
-	errEmptyPort           = errors.New("SMTP port config is empty")
-	errEmptyUser           = errors.New("SMTP user is empty")
-	errEmptySenderIdentity = errors.New("SMTP sender identity is empty")
-	errEmptySenderEmail    = errors.New("SMTP sender email is empty")
-	errEmptyReceiverEmails = errors.New("no receiver emails configured")
-)
-
 type example interface {
 	Email() hermes.Email
 	Name() string
@@ -67,31 +61,31 @@ func main() {
 			bytePassword, _ := term.ReadPassword(0)
 			password = string(bytePassword)
 		}
-		smtpConfig := smtpAuthentication{
-			Server:         os.Getenv("HERMES_SMTP_SERVER"),
-			Port:           port,
-			SenderEmail:    os.Getenv("HERMES_SENDER_EMAIL"),
-			SenderIdentity: os.Getenv("HERMES_SENDER_IDENTITY"),
-			SMTPPassword:   password,
-			SMTPUser:       SMTPUser,
+		sender, err := transport.NewSMTP(transport.SMTPConfig{
+			Host:     os.Getenv("HERMES_SMTP_SERVER"),
+			Port:     port,
+			Username: SMTPUser,
+			Password: password,
+			Auth:     mail.SMTPAuthPlain,
+			SSL:      port == 465,
+		})
+		if err != nil {
+			panic(err)
 		}
-		options := sendOptions{
-			To: os.Getenv("HERMES_TO"),
+		env := hermes.Envelope{
+			From: (&netmail.Address{Name: os.Getenv("HERMES_SENDER_IDENTITY"), Address: os.Getenv("HERMES_SENDER_EMAIL")}).String(),
+			To:   strings.Split(os.Getenv("HERMES_TO"), ","),
 		}
 		for _, theme := range themes {
 			h.Theme = theme
 			for _, e := range examples {
-				options.Subject = "Hermes | " + h.Theme.Name() + " | " + e.Name()
-				fmt.Printf("Sending email '%s'...\n", options.Subject)
-				htmlBytes, err := os.ReadFile(fmt.Sprintf("%v/%v.%v.html", h.Theme.Name(), h.Theme.Name(), e.Name()))
-				if err != nil {
-					panic(err)
-				}
-				txtBytes, err := os.ReadFile(fmt.Sprintf("%v/%v.%v.txt", h.Theme.Name(), h.Theme.Name(), e.Name()))
+				env.Subject = "Hermes | " + h.Theme.Name() + " | " + e.Name()
+				fmt.Printf("Sending email '%s'...\n", env.Subject)
+				msg, err := h.BuildMessage(env, e.Email())
 				if err != nil {
 					panic(err)
 				}
-				err = send(smtpConfig, options, string(htmlBytes), string(txtBytes))
+				err = sender.Send(context.Background(), msg)
 				if err != nil {
 					panic(err)
 				}
@@ -125,80 +119,3 @@ func generateEmails(h hermes.Hermes, email hermes.Email, example string) {
 		panic(err)
 	}
 }
-
-type smtpAuthentication struct {
-	Server         string
-	Port           int
-	SenderEmail    string
-	SenderIdentity string
-	SMTPUser       string
-	SMTPPassword   string
-}
-
-// sendOptions are options for sending an email
-type sendOptions struct {
-	To      string
-	Subject string
-}
-
-// send sends the email
-func send(smtpConfig smtpAuthentication, options sendOptions, htmlBody string, txtBody string) error {
-
-	if smtpConfig.Server == "" {
-		return errEmptyServerConfig
-	}
-
-	if smtpConfig.Port == 0 {
-		return errEmptyPort
-	}
-
-	if smtpConfig.SMTPUser == "" {
-		return errEmptyUser
-	}
-
-	if smtpConfig.SenderIdentity == "" {
-		return errEmptySenderIdentity
-	}
-
-	if smtpConfig.SenderEmail == "" {
-		return errEmptySenderEmail
-	}
-
-	if options.To == "" {
-		return errEmptyReceiverEmails
-	}
-
-	// Create new message
-	m := mail.NewMsg()
-
-	// Set sender with name and email
-	if err := m.FromFormat(smtpConfig.SenderIdentity, smtpConfig.SenderEmail); err != nil {
-		return err
-	}
-
-	// Set recipients
-	if err := m.To(options.To); err != nil {
-		return err
-	}
-
-	// Set subject
-	m.Subject(options.Subject)
-
-	// Set body - text/plain as primary, text/html as alternative
-	m.SetBodyString(mail.TypeTextPlain, txtBody)
-	m.AddAlternativeString(mail.TypeTextHTML, htmlBody)
-
-	// Create SMTP client
-	client, err := mail.NewClient(smtpConfig.Server,
-		mail.WithPort(smtpConfig.Port),
-		mail.WithUsername(smtpConfig.SMTPUser),
-		mail.WithPassword(smtpConfig.SMTPPassword),
-		mail.WithSMTPAuth(mail.SMTPAuthPlain),
-	)
-	if err != nil {
-		return err
-	}
-
-	// Send the message
-	return client.DialAndSend(m)
-}
@@ -0,0 +1,140 @@
+package hermes
+
+import (
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+)
+
+// ThemeExtension describes a theme extending a base theme with ExtendTheme.
+//
+// The templates of the default theme are made of blocks: head, masthead,
+// greeting, intros, dictionary, tables, actions, outros, attachments,
+// signature, trouble and footer, and of the button partial rendering the
+// button of an action. An extension overrides them with define actions:
+//
+//	{{ define "footer" }}<tr><td class="content-cell">Sent by {{ .Hermes.Product.Name }}</td></tr>{{ end }}
+type ThemeExtension struct {
+	Name      string           // Name of the theme
+	HTML      string           // Blocks and partials overriding the ones of the base HTML template
+	PlainText string           // Blocks and partials overriding the ones of the base plain text template
+	Tokens    Tokens           // Tokens applied to the styles of the base theme
+	Styles    StylesDefinition // Styles merged on top of the styles of the base theme, once the tokens applied
+}
+
+// extendedTheme is a theme made with ExtendTheme
+type extendedTheme struct {
+	info   ThemeInfo
+	tokens Tokens
+	styles StylesDefinition
+	sheet  Stylesheet
+
+	// sources of the templates, from the base template to the last overrides
+	html      []string
+	plainText []string
+
+	parsedHTML      *template.Template
+	parsedPlainText *template.Template
+}
+
+// ExtendTheme returns a theme made of base, with the blocks, partials and
+// styles of ext on top of it. The base theme may itself be an extended theme.
+func ExtendTheme(base Theme, ext ThemeExtension) (ThemedTemplate, error) {
+	return extendTheme(base, ext)
+}
+
+func extendTheme(base Theme, ext ThemeExtension) (*extendedTheme, error) {
+	if base == nil || strings.TrimSpace(ext.Name) == "" {
+		return nil, ErrInvalidTheme
+	}
+
+	info := DescribeTheme(base)
+	t := &extendedTheme{
+		info:   ThemeInfo{Name: ext.Name, Extends: info.Name, Features: info.Features},
+		tokens: ext.Tokens.over(themeTokens(base)),
+		styles: ext.Styles.mergeInto(ext.Tokens.applyTo(base.Styles().clone())),
+	}
+	if b, ok := base.(*extendedTheme); ok {
+		t.html = append(slices.Clip(b.html), ext.HTML)
+		t.plainText = append(slices.Clip(b.plainText), ext.PlainText)
+	} else {
+		t.html = []string{base.HTMLTemplate(), ext.HTML}
+		t.plainText = []string{base.PlainTextTemplate(), ext.PlainText}
+	}
+
+	var err error
+	if t.parsedHTML, err = parseTemplates(t.html); err != nil {
+		return nil, fmt.Errorf("extending theme %s: HTML template: %w", info.Name, err)
+	}
+	if t.parsedPlainText, err = parseTemplates(t.plainText); err != nil {
+		return nil, fmt.Errorf("extending theme %s: plain text template: %w", info.Name, err)
+	}
+	if b, ok := base.(StylesheetTheme); ok {
+		t.sheet = b.Stylesheet().WithStyles(t.styles)
+	}
+	return t, nil
+}
+
+// parseTemplates parses the sources in order, the templates defined by a
+// source replacing the ones of the previous sources
+func parseTemplates(sources []string) (*template.Template, error) {
+	t := TemplateBase()
+	for _, source := range sources {
+		if _, err := t.Parse(source); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Name returns the name of the theme
+func (t *extendedTheme) Name() string {
+	return t.info.Name
+}
+
+// Info returns the description of the theme
+func (t *extendedTheme) Info() ThemeInfo {
+	info := t.info
+	info.Features = slices.Clone(t.info.Features)
+	return info
+}
+
+// Tokens returns the tokens of the base theme, overridden by the extension ones
+func (t *extendedTheme) Tokens() Tokens {
+	return t.tokens
+}
+
+// Styles returns the styles of the base theme merged with the extension ones
+func (t *extendedTheme) Styles() StylesDefinition {
+	return t.styles.clone()
+}
+
+// Stylesheet returns the styles of the theme, in the order of the stylesheet
+// of the base theme, or sorted when the base theme has none
+func (t *extendedTheme) Stylesheet() Stylesheet {
+	if t.sheet == nil {
+		return t.styles.Stylesheet()
+	}
+	return t.sheet.clone()
+}
+
+// HTMLTemplate returns the HTML template of the base theme, whose blocks
+// are overridden by the template returned by ParsedHTMLTemplate
+func (t *extendedTheme) HTMLTemplate() string {
+	return t.html[0]
+}
+
+// PlainTextTemplate returns the plain text template of the base theme, whose
+// blocks are overridden by the template returned by ParsedPlainTextTemplate
+func (t *extendedTheme) PlainTextTemplate() string {
+	return t.plainText[0]
+}
+
+func (t *extendedTheme) ParsedHTMLTemplate() (*template.Template, error) {
+	return t.parsedHTML, nil
+}
+
+func (t *extendedTheme) ParsedPlainTextTemplate() (*template.Template, error) {
+	return t.parsedPlainText, nil
+}
@@ -0,0 +1,112 @@
+package hermes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var extendEmail = Email{Body: Body{
+	Name:    "Jon Snow",
+	Intros:  []string{"Welcome to Hermes!"},
+	Actions: []Action{{Instructions: "To get started, please click here:", Button: Button{Text: "Confirm", Link: "https://hermes-example.com/confirm"}}},
+}}
+
+func renderTheme(t *testing.T, theme Theme, email Email) *Rendered {
+	t.Helper()
+	r, err := New(Hermes{Theme: theme, Product: Product{Name: "Hermes", Link: "https://example-hermes.com/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := r.Render(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestExtendTheme(t *testing.T) {
+	theme, err := ExtendTheme(new(Default), ThemeExtension{
+		Name:      "corporate",
+		HTML:      `{{ define "footer" }}<tr><td class="corporate-footer">Sent by {{ .Hermes.Product.Name }}</td></tr>{{ end }}`,
+		PlainText: `{{ define "footer" }}Sent by {{ .Hermes.Product.Name }}{{ end }}`,
+		Styles:    StylesDefinition{".corporate-footer": {"color": "#123456"}, "body": {"color": "#000000"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "corporate", theme.Name())
+	assert.Equal(t, ThemeInfo{Name: "corporate", Extends: "default", Features: []string{"responsive", "rtl"}}, DescribeTheme(theme))
+	assert.Equal(t, Default{}.HTMLTemplate(), theme.HTMLTemplate())
+
+	styles := theme.Styles()
+	assert.Equal(t, "#123456", styles[".corporate-footer"]["color"])
+	assert.Equal(t, "#000000", styles["body"]["color"])
+	assert.Equal(t, GetDefaultStyles()["body"]["background-color"], styles["body"]["background-color"], "Base styles should be kept")
+
+	res := renderTheme(t, theme, extendEmail)
+	assert.Contains(t, res.HTML, "Sent by Hermes")
+	assert.NotContains(t, res.HTML, "Delivered by")
+	assert.Contains(t, res.HTML, "Welcome to Hermes!", "Blocks not overridden should be kept")
+	assert.Contains(t, res.Text, "Sent by Hermes")
+	assert.NotContains(t, res.Text, "https://example-hermes.com/\n")
+
+	// The base theme is left untouched
+	assert.Contains(t, renderTheme(t, new(Default), extendEmail).HTML, "Delivered by")
+
+	// Extended themes can be extended in turn
+	child, err := ExtendTheme(theme, ThemeExtension{
+		Name: "corporate-sales",
+		HTML: `{{ define "masthead" }}<tr><td>Sales team</td></tr>{{ end }}`,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "corporate", DescribeTheme(child).Extends)
+	assert.Equal(t, "#123456", child.Styles()[".corporate-footer"]["color"])
+	res = renderTheme(t, child, extendEmail)
+	assert.Contains(t, res.HTML, "Sales team")
+	assert.Contains(t, res.HTML, "Sent by Hermes")
+	assert.NotContains(t, renderTheme(t, theme, extendEmail).HTML, "Sales team")
+}
+
+func TestExtendTheme_Partial(t *testing.T) {
+	theme, err := ExtendTheme(new(Flat), ThemeExtension{
+		Name: "links",
+		HTML: `{{ define "button" }}<a class="link" href="{{ .Action.Button.Link }}">{{ .Action.Button.Text }}</a>{{ end }}`,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	html := renderTheme(t, theme, extendEmail).HTML
+	assert.Contains(t, html, `href="https://hermes-example.com/confirm"`)
+	assert.Contains(t, html, ">Confirm</a>")
+	assert.Contains(t, html, "To get started, please click here:")
+	assert.NotContains(t, html, "v:roundrect")
+}
+
+func TestExtendTheme_Errors(t *testing.T) {
+	_, err := ExtendTheme(nil, ThemeExtension{Name: "nil"})
+	assert.ErrorIs(t, err, ErrInvalidTheme)
+	_, err = ExtendTheme(new(Default), ThemeExtension{Name: " "})
+	assert.ErrorIs(t, err, ErrInvalidTheme)
+
+	_, err = ExtendTheme(new(Default), ThemeExtension{Name: "broken", HTML: `{{ define "footer" }}`})
+	assert.ErrorContains(t, err, "extending theme default: HTML template")
+	_, err = ExtendTheme(new(Default), ThemeExtension{Name: "broken", PlainText: `{{ .Hermes `})
+	assert.ErrorContains(t, err, "extending theme default: plain text template")
+}
+
+func TestButton_VML(t *testing.T) {
+	html := renderTheme(t, new(Default), extendEmail).HTML
+	assert.Contains(t, html, `arcsize="10%" strokecolor="#3869d4" fillcolor="#3869d4"`)
+
+	html = renderTheme(t, new(Flat), extendEmail).HTML
+	assert.Contains(t, html, `arcsize="0%" strokecolor="#00948d" fillcolor="#00948d"`, "Outlook buttons should follow the styles of the theme")
+
+	email := extendEmail
+	email.Body.CSS = StylesDefinition{".button": {"background-color": "#ff6600", "border-radius": "0px"}}
+	html = renderTheme(t, new(Default), email).HTML
+	assert.Contains(t, html, `arcsize="0%" strokecolor="#ff6600" fillcolor="#ff6600"`)
+}
@@ -5,11 +5,6 @@ import (
 	"html/template"
 )
 
-var (
-	parsedFlatHTML      = template.Must(TemplateBase().Parse(Flat{}.HTMLTemplate()))
-	parsedFlatPlainText = template.Must(TemplateBase().Parse(Flat{}.PlainTextTemplate()))
-)
-
 // Flat is another built-in theme
 type Flat struct{}
 
@@ -18,39 +13,37 @@ func (dt Flat) Name() string {
 	return "flat"
 }
 
-func (dt Flat) Styles() StylesDefinition {
-	base := GetDefaultStyles()
-	styles := StylesDefinition{}
-	for sel, props := range base {
-		cloned := map[string]any{}
-		for k, v := range props {
-			cloned[k] = v
-		}
-		styles[sel] = cloned
+// Info describes the flat theme
+func (dt Flat) Info() ThemeInfo {
+	return ThemeInfo{
+		Name:        dt.Name(),
+		Description: "Default theme with a dark background and square buttons",
+		Features:    []string{"responsive", "rtl"},
 	}
+}
 
-	// Ensure keys exist before mutation (defensive for parser changes)
-	ensure := func(sel string) map[string]any {
-		if m, ok := styles[sel]; ok && m != nil {
-			return m
-		}
-		m := map[string]any{}
-		styles[sel] = m
-		return m
-	}
+// Tokens returns the design tokens of the flat theme: the default ones with
+// a dark background and square buttons
+func (dt Flat) Tokens() Tokens {
+	tokens := Default{}.Tokens()
+	tokens.Primary = "#00948d"
+	tokens.Background = "#2c3e50"
+	tokens.Radius = "0"
+	return tokens
+}
 
-	ensure("body")["background-color"] = "#2c3e50"
-	ensure(".email-wrapper")["background-color"] = "#2c3e50"
-	ensure(".email-footer p")["color"] = "#eaeaea"
-	ensure(".button")["background-color"] = "#00948d"
-	ensure(".button")["border-radius"] = "0"
+func (dt Flat) Styles() StylesDefinition {
+	return dt.Tokens().Styles()
+}
 
-	return styles
+// Stylesheet returns the styles of the flat theme, in the order of the default theme
+func (dt Flat) Stylesheet() Stylesheet {
+	return defaultStylesheet.WithStyles(dt.Styles())
 }
 
 // HTMLTemplate returns a Golang template that will generate an HTML email.
 func (dt Flat) HTMLTemplate() string {
-	// Reuse the default HTML template; styling differences handled via CSS & template vars
+	// Reuse the default HTML template; styling differences are handled by the tokens
 	return getTemplate(fmt.Sprintf(htmlEmail, "default"))
 }
 
@@ -60,9 +53,9 @@ func (dt Flat) PlainTextTemplate() string {
 }
 
 func (dt Flat) ParsedHTMLTemplate() (*template.Template, error) {
-	return parsedFlatHTML, nil
+	return parsedDefaultHTML, nil
 }
 
 func (dt Flat) ParsedPlainTextTemplate() (*template.Template, error) {
-	return parsedFlatPlainText, nil
+	return parsedDefaultPlainText, nil
 }
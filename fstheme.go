@@ -0,0 +1,195 @@
+package hermes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Files of a theme directory read by LoadTheme
+const (
+	ThemeHTMLFile      = "theme.tpl.html"
+	ThemePlainTextFile = "theme.tpl.txt"
+	ThemeCSSFile       = "theme.css"
+	ThemeManifestFile  = "theme.json"
+)
+
+// ThemeInfo describes a theme, e.g. in the theme.json manifest of a theme directory:
+//
+//	{"name": "corporate", "description": "Our brand colors", "features": ["rtl"]}
+type ThemeInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Features    []string `json:"features,omitempty"` // Features supported by the theme, e.g. rtl
+	Extends     string   `json:"extends,omitempty"`  // Name of the theme extended by the theme, see ExtendTheme
+}
+
+// manifest is the content of theme.json
+type manifest struct {
+	ThemeInfo
+	Tokens Tokens `json:"tokens"` // Tokens applied to the extended theme
+}
+
+// fsTheme is a theme loaded from a directory
+type fsTheme struct {
+	info      ThemeInfo
+	html      string
+	plainText string
+	styles    StylesDefinition
+	sheet     Stylesheet
+
+	parsedHTML      *template.Template
+	parsedPlainText *template.Template
+}
+
+// LoadTheme loads the theme of the dir directory of fsys, made of:
+//
+//   - theme.tpl.html, the template of HTML emails
+//   - theme.tpl.txt, the template of plain text emails
+//   - theme.css, the styles of the theme
+//   - theme.json, an optional manifest holding the ThemeInfo of the theme,
+//     whose name default to the base name of dir
+//
+// When the manifest names a registered theme in extends, the theme extends
+// it with ExtendTheme: the templates hold the blocks overriding the ones of
+// the extended theme, the tokens of the manifest and the styles are applied
+// on top of its styles, and every file but the manifest is optional:
+//
+//	{"name": "corporate", "extends": "default", "tokens": {"primary": "#ff6600"}}
+//
+// Templates are parsed with TemplateBase. Use os.DirFS to load a theme from disk.
+func LoadTheme(fsys fs.FS, dir string) (ThemedTemplate, error) {
+	t, err := loadTheme(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("loading theme %s: %w", dir, err)
+	}
+	return t, nil
+}
+
+func loadTheme(fsys fs.FS, dir string) (ThemedTemplate, error) {
+	read := func(name string) (string, error) {
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		return string(data), err
+	}
+
+	m := manifest{ThemeInfo: ThemeInfo{Name: path.Base(dir)}}
+	data, err := read(ThemeManifestFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		dec := json.NewDecoder(strings.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("%s: %w", ThemeManifestFile, err)
+		}
+	}
+	switch {
+	case m.Name == "" || m.Name == "." || m.Name == "/":
+		return nil, fmt.Errorf("%s: theme has no name", ThemeManifestFile)
+	case m.Extends != "":
+		return loadExtension(m, read)
+	case m.Tokens != Tokens{}:
+		return nil, fmt.Errorf("%s: tokens are only applied to an extended theme", ThemeManifestFile)
+	}
+
+	t := &fsTheme{info: m.ThemeInfo}
+
+	if t.html, err = read(ThemeHTMLFile); err != nil {
+		return nil, err
+	}
+	if t.plainText, err = read(ThemePlainTextFile); err != nil {
+		return nil, err
+	}
+	css, err := read(ThemeCSSFile)
+	if err != nil {
+		return nil, err
+	}
+	t.sheet = ParseStylesheet(css)
+	t.styles = t.sheet.Styles()
+
+	if t.parsedHTML, err = TemplateBase().Parse(t.html); err != nil {
+		return nil, fmt.Errorf("%s: %w", ThemeHTMLFile, err)
+	}
+	if t.parsedPlainText, err = TemplateBase().Parse(t.plainText); err != nil {
+		return nil, fmt.Errorf("%s: %w", ThemePlainTextFile, err)
+	}
+	return t, nil
+}
+
+// loadExtension loads the files of a theme extending the theme named in its manifest
+func loadExtension(m manifest, read func(name string) (string, error)) (ThemedTemplate, error) {
+	base, err := LookupTheme(m.Extends)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ThemeManifestFile, err)
+	}
+
+	ext := ThemeExtension{Name: m.Name, Tokens: m.Tokens}
+	for name, content := range map[string]*string{ThemeHTMLFile: &ext.HTML, ThemePlainTextFile: &ext.PlainText} {
+		if *content, err = read(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	switch css, err := read(ThemeCSSFile); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		ext.Styles = ParseStylesDefinition(css)
+	}
+
+	t, err := extendTheme(base, ext)
+	if err != nil {
+		return nil, err
+	}
+	if m.Features == nil {
+		m.Features = t.info.Features
+	}
+	t.info = m.ThemeInfo
+	return t, nil
+}
+
+// Name returns the name of the theme
+func (t *fsTheme) Name() string {
+	return t.info.Name
+}
+
+// Info returns the description of the theme
+func (t *fsTheme) Info() ThemeInfo {
+	info := t.info
+	info.Features = append([]string(nil), t.info.Features...)
+	return info
+}
+
+// Styles returns the styles of theme.css
+func (t *fsTheme) Styles() StylesDefinition {
+	return t.styles.clone()
+}
+
+// Stylesheet returns the styles of theme.css, in order and with their at-rules
+func (t *fsTheme) Stylesheet() Stylesheet {
+	return t.sheet.clone()
+}
+
+// HTMLTemplate returns the content of theme.tpl.html
+func (t *fsTheme) HTMLTemplate() string {
+	return t.html
+}
+
+// PlainTextTemplate returns the content of theme.tpl.txt
+func (t *fsTheme) PlainTextTemplate() string {
+	return t.plainText
+}
+
+func (t *fsTheme) ParsedHTMLTemplate() (*template.Template, error) {
+	return t.parsedHTML, nil
+}
+
+func (t *fsTheme) ParsedPlainTextTemplate() (*template.Template, error) {
+	return t.parsedPlainText, nil
+}
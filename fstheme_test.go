@@ -0,0 +1,148 @@
+package hermes
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// defaultThemeFS returns the files of the default theme laid out as a theme directory
+func defaultThemeFS(t *testing.T, dir string) fstest.MapFS {
+	t.Helper()
+	files := fstest.MapFS{}
+	for name, embedded := range map[string]string{
+		ThemeHTMLFile:      "templates/default.tpl.html",
+		ThemePlainTextFile: "templates/default.tpl.txt",
+		ThemeCSSFile:       "templates/default.css",
+	} {
+		data, err := staticFS.ReadFile(embedded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path.Join(dir, name)] = &fstest.MapFile{Data: data}
+	}
+	return files
+}
+
+func TestLoadTheme(t *testing.T) {
+	fsys := defaultThemeFS(t, "themes/corporate")
+	theme, err := LoadTheme(fsys, "themes/corporate")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "corporate", theme.Name(), "Name should default to the directory name")
+	assert.Equal(t, GetDefaultStyles(), theme.Styles())
+	assert.Equal(t, Default{}.HTMLTemplate(), theme.HTMLTemplate())
+
+	// The loaded theme renders like the default theme
+	email := Email{Body: Body{Name: "Jon Snow", Intros: []string{"Welcome to Hermes!"}}}
+	want, err := New(Hermes{Product: Product{Name: "Hermes"}})
+	assert.NoError(t, err)
+	got, err := New(Hermes{Theme: theme, Product: Product{Name: "Hermes"}})
+	assert.NoError(t, err)
+	wantRes, err := want.Render(context.Background(), email)
+	assert.NoError(t, err)
+	gotRes, err := got.Render(context.Background(), email)
+	assert.NoError(t, err)
+	assert.Equal(t, wantRes.HTML, strings.ReplaceAll(gotRes.HTML, "theme-corporate", "theme-default"))
+	assert.Equal(t, wantRes.Text, gotRes.Text)
+
+	// Styles are copied
+	theme.Styles()["body"]["color"] = "red"
+	assert.NotEqual(t, "red", theme.Styles()["body"]["color"])
+}
+
+func TestLoadTheme_Manifest(t *testing.T) {
+	fsys := defaultThemeFS(t, "brand")
+	fsys["brand/theme.json"] = &fstest.MapFile{Data: []byte(`{"name": "corporate", "description": "Our brand colors", "features": ["rtl"]}`)}
+	theme, err := LoadTheme(fsys, "brand")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "corporate", theme.Name())
+	info := theme.(interface{ Info() ThemeInfo }).Info()
+	assert.Equal(t, ThemeInfo{Name: "corporate", Description: "Our brand colors", Features: []string{"rtl"}}, info)
+
+	root := defaultThemeFS(t, ".")
+	_, err = LoadTheme(root, ".")
+	assert.ErrorContains(t, err, "theme has no name")
+	root[ThemeManifestFile] = &fstest.MapFile{Data: []byte(`{"name": "root"}`)}
+	theme, err = LoadTheme(root, ".")
+	assert.NoError(t, err)
+	assert.Equal(t, "root", theme.Name())
+}
+
+func TestLoadTheme_Extends(t *testing.T) {
+	fsys := fstest.MapFS{
+		"brand/theme.json":     {Data: []byte(`{"description": "Flat theme with our footer", "extends": "flat"}`)},
+		"brand/theme.tpl.html": {Data: []byte(`{{ define "footer" }}<tr><td>Sent by {{ .Hermes.Product.Name }}</td></tr>{{ end }}`)},
+		"brand/theme.css":      {Data: []byte(`.button { background-color: #ff6600; }`)},
+	}
+	theme, err := LoadTheme(fsys, "brand")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, ThemeInfo{Name: "brand", Description: "Flat theme with our footer", Extends: "flat", Features: []string{"responsive", "rtl"}}, DescribeTheme(theme))
+	assert.Equal(t, "#ff6600", theme.Styles()[".button"]["background-color"])
+	assert.Equal(t, "0", theme.Styles()[".button"]["border-radius"], "Styles of the extended theme should be kept")
+
+	res := renderTheme(t, theme, extendEmail)
+	assert.Contains(t, res.HTML, "Sent by Hermes")
+	assert.Contains(t, res.HTML, `fillcolor="#ff6600"`)
+	assert.Equal(t, renderTheme(t, new(Flat), extendEmail).Text, res.Text, "Plain text template is optional")
+
+	fsys["brand/theme.json"] = &fstest.MapFile{Data: []byte(`{"extends": "default", "tokens": {"primary": "#123456", "spacing": 4}}`)}
+	theme, err = LoadTheme(fsys, "brand")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "#123456", theme.Styles()["a"]["color"])
+	assert.Equal(t, "#ff6600", theme.Styles()[".button"]["background-color"], "Styles should be applied after tokens")
+	assert.Equal(t, "28px", theme.Styles()[".content-cell"]["padding"])
+
+	fsys["brand/theme.json"] = &fstest.MapFile{Data: []byte(`{"extends": "fancy"}`)}
+	_, err = LoadTheme(fsys, "brand")
+	assert.ErrorIs(t, err, ErrUnknownTheme)
+}
+
+func TestLoadTheme_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(fsys fstest.MapFS)
+		err    string
+	}{
+		{"missing HTML template", func(fsys fstest.MapFS) { delete(fsys, "theme/theme.tpl.html") }, "theme.tpl.html"},
+		{"missing plain text template", func(fsys fstest.MapFS) { delete(fsys, "theme/theme.tpl.txt") }, "theme.tpl.txt"},
+		{"missing styles", func(fsys fstest.MapFS) { delete(fsys, "theme/theme.css") }, "theme.css"},
+		{"invalid HTML template", func(fsys fstest.MapFS) {
+			fsys["theme/theme.tpl.html"] = &fstest.MapFile{Data: []byte("{{ if .Email }}")}
+		}, "theme.tpl.html"},
+		{"invalid plain text template", func(fsys fstest.MapFS) {
+			fsys["theme/theme.tpl.txt"] = &fstest.MapFile{Data: []byte("{{ .Email.Body.Name ")}
+		}, "theme.tpl.txt"},
+		{"invalid manifest", func(fsys fstest.MapFS) {
+			fsys["theme/theme.json"] = &fstest.MapFile{Data: []byte(`{"nme": "typo"}`)}
+		}, `unknown field "nme"`},
+		{"tokens without extended theme", func(fsys fstest.MapFS) {
+			fsys["theme/theme.json"] = &fstest.MapFile{Data: []byte(`{"tokens": {"primary": "#ff6600"}}`)}
+		}, "tokens are only applied to an extended theme"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := defaultThemeFS(t, "theme")
+			test.change(fsys)
+			theme, err := LoadTheme(fsys, "theme")
+			assert.Nil(t, theme)
+			assert.ErrorContains(t, err, "loading theme theme")
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+
+	_, err := LoadTheme(fstest.MapFS{}, "missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -2,13 +2,14 @@ package hermes
 
 import (
 	"bytes"
+	"context"
 	"html/template"
+	"io/fs"
+	"slices"
+	"strings"
 
 	"dario.cat/mergo"
 	"github.com/Masterminds/sprig/v3"
-	"github.com/inbucket/html2text"
-	"github.com/sirupsen/logrus"
-	"github.com/vanng822/go-premailer/premailer"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 )
@@ -19,6 +20,18 @@ type Hermes struct {
 	TextDirection      TextDirection
 	Product            Product
 	DisableCSSInlining bool
+	// Inliner inlines the CSS of HTML emails, unless DisableCSSInlining is set
+	// (default to PremailerInliner, with its default options)
+	Inliner Inliner
+	// Images provides the images embedded in built messages: an <img> source
+	// (or Product.Logo) naming a file of Images is replaced by a cid: URL and
+	// the file is attached inline (see ImageMap for in-memory images)
+	Images fs.FS
+	// ListAttachments lists the names of the attached files at the end of emails
+	ListAttachments bool
+	// DarkMode adds the dark palette of the theme tokens to HTML emails, for the
+	// email clients displaying emails in dark mode (Apple Mail, Outlook...)
+	DarkMode bool
 }
 
 type ThemedTemplate interface {
@@ -50,6 +63,11 @@ func normalizeStyles(v any) StylesDefinition {
 	case map[string]map[string]interface{}:
 		out := StylesDefinition{}
 		for sel, props := range css {
+			if props == nil {
+				// Keep the selector removed by mergeInto
+				out[sel] = nil
+				continue
+			}
 			cp := map[string]any{}
 			for k, val := range props {
 				cp[k] = val
@@ -62,19 +80,72 @@ func normalizeStyles(v any) StylesDefinition {
 	}
 }
 
+// Unset, as the value of a property of styles merged into other styles,
+// removes the property from them
+var Unset = unset{}
+
+type unset struct{}
+
+// Important, as the value of a property of styles merged into other styles,
+// sets the property with !important, e.g. "color": Important("#ffffff")
+type Important string
+
+// Replace, as a property of a selector of styles merged into other styles
+// and set to true, replaces the properties of the selector instead of merging
+// into them, e.g. ".button": {Replace: true, "color": "#ffffff"}
+const Replace = "!replace"
+
+// MergeCSSWithTheme returns the theme styles with s merged on top of them.
+// Neither s nor the map returned by theme.Styles() is modified.
+//
+// A property set to nil or Unset is removed, a property set to an Important
+// value is marked !important, and a selector set to nil is removed. See also
+// Replace.
 func (s StylesDefinition) MergeCSSWithTheme(theme Theme) StylesDefinition {
-	themeStyles := theme.Styles()
+	return s.mergeInto(theme.Styles().clone())
+}
+
+// mergeInto merges the properties of s into dst and returns dst, following
+// the rules of MergeCSSWithTheme.
+func (s StylesDefinition) mergeInto(dst StylesDefinition) StylesDefinition {
 	for sel, props := range s {
-		if defProps, exists := themeStyles[sel]; exists {
-			for k, v := range props {
-				defProps[k] = v
+		if props == nil {
+			delete(dst, sel)
+			continue
+		}
+		defProps := dst[sel]
+		if defProps == nil || props[Replace] == true {
+			defProps = make(map[string]any, len(props))
+			dst[sel] = defProps
+		}
+		for k, v := range props {
+			switch v := v.(type) {
+			case nil, unset:
+				delete(defProps, k)
+			case Important:
+				defProps[k] = string(v) + " !important"
+			default:
+				if k != Replace {
+					defProps[k] = v
+				}
 			}
-			themeStyles[sel] = defProps
-		} else {
-			themeStyles[sel] = props
 		}
 	}
-	return themeStyles
+	return dst
+}
+
+// clone returns a deep copy of s, so that the copy can be modified without
+// affecting the styles held by a theme.
+func (s StylesDefinition) clone() StylesDefinition {
+	out := make(StylesDefinition, len(s))
+	for sel, props := range s {
+		cp := make(map[string]any, len(props))
+		for k, v := range props {
+			cp[k] = v
+		}
+		out[sel] = cp
+	}
+	return out
 }
 
 // ParsedHTMLTheme is implemented by themes that parse their HTML
@@ -104,6 +175,9 @@ var templateFuncs = template.FuncMap{
 
 		return template.CSS(s)
 	},
+	"tokens":              themeTokens,
+	"stylesheet":          renderStylesheet,
+	"preservedStylesheet": renderPreservedStylesheet,
 }
 
 // TDLeftToRight is the text direction from left to right (default)
@@ -118,16 +192,22 @@ type Product struct {
 	Name      string
 	Link      string // e.g. https://matcornic.github.io
 	Logo      string // e.g. https://matcornic.github.io/img/logo.png
+	LogoDark  string // Logo displayed in dark mode instead of Logo, e.g. a light version of it (see Hermes.DarkMode)
 	Copyright string // Copyright © 2019 Hermes. All rights reserved.
 	// TroubleText is the sentence at the end of the email for users having trouble with the button
 	// (default to `If you’re having trouble with the button '{ACTION}',
 	// copy and paste the URL below into your web browser.`)
 	TroubleText string
+	// AttachmentsText introduces the list of attached files when Hermes.ListAttachments is set
+	// (default to `Attached:`)
+	AttachmentsText string
 }
 
 // Email is the email containing a body
 type Email struct {
-	Body Body
+	Body        Body         // Body of the email
+	Attachments []Attachment // Files sent along with the email when building a message
+	Subject     string       // Subject of the email (default to Body.Title)
 }
 
 // Markdown is a HTML template (a string) representing Markdown content
@@ -151,7 +231,9 @@ type Body struct {
 	Signature         string           // Signature for the contacted person (default to 'Yours truly' when SignatureName is provided)
 	SignatureName     string           // Name for the signature
 	Title             string           // Title replaces the greeting+name when set
+	Preheader         string           // Preheader is the inbox preview text, hidden in the email (default to the first intro)
 	FreeMarkdown      Markdown         // Free markdown content that replaces all content other than header and footer
+	Blocks            Blocks           // Blocks are content blocks rendered in order, after the dictionary, tables and actions, and before the outros
 	CSS               StylesDefinition // CSS styles to override theme defaults
 	TemplateOverrides map[string]any   // TemplateOverrides is a map of key-value pairs that can be used to override the default template values
 }
@@ -224,6 +306,13 @@ type Template struct {
 }
 
 func setDefaultEmailValues(h *Hermes, e *Email) error {
+	return prepareEmail(h.Theme.Styles(), e)
+}
+
+// prepareEmail merges the default email values into e and resolves the final
+// styles of the email from base. base is never modified, and maps and slices
+// of e shared with the caller are replaced rather than written to.
+func prepareEmail(base StylesDefinition, e *Email) error {
 	// Default values of an email
 	defaultEmail := Email{
 		Body: Body{
@@ -240,7 +329,11 @@ func setDefaultEmailValues(h *Hermes, e *Email) error {
 		return err
 	}
 
-	styles := h.Theme.Styles()
+	if e.Body.Preheader == "" {
+		e.Body.Preheader = preheader(*e)
+	}
+
+	styles := base.clone()
 
 	// Handle body_width override
 	if e.Body.TemplateOverrides != nil {
@@ -257,20 +350,25 @@ func setDefaultEmailValues(h *Hermes, e *Email) error {
 
 	// Merge user CSS overrides if present (support both new CSS field and legacy TemplateOverrides)
 	if e.Body.CSS != nil {
-		styles = e.Body.CSS.MergeCSSWithTheme(h.Theme)
+		styles = e.Body.CSS.mergeInto(styles)
 	} else if e.Body.TemplateOverrides != nil {
 		if raw, ok := e.Body.TemplateOverrides["css"]; ok {
 			if userStyles := normalizeStyles(raw); userStyles != nil {
-				styles = userStyles.MergeCSSWithTheme(h.Theme)
+				styles = userStyles.mergeInto(styles)
 			}
 		}
 	}
 
-	// Ensure TemplateOverrides exists and contains the final styles
-	if e.Body.TemplateOverrides == nil {
-		e.Body.TemplateOverrides = make(map[string]any)
+	// Resolve the CSS variables the templates may read, e.g. the color of VML buttons
+	resolveStylesVariables(styles)
+
+	// Copy TemplateOverrides so that the final styles never leak into the caller's map
+	overrides := make(map[string]any, len(e.Body.TemplateOverrides)+1)
+	for k, v := range e.Body.TemplateOverrides {
+		overrides[k] = v
 	}
-	e.Body.TemplateOverrides["css"] = styles
+	overrides["css"] = styles
+	e.Body.TemplateOverrides = overrides
 
 	return nil
 }
@@ -282,9 +380,10 @@ func setDefaultHermesValues(h *Hermes) error {
 		Theme:         new(Default),
 		TextDirection: defaultTextDirection,
 		Product: Product{
-			Name:        "Hermes",
-			Copyright:   "Copyright © 2025 Hermes. All rights reserved.",
-			TroubleText: "If you’re having trouble with the button '{ACTION}', copy and paste the URL below into your web browser.",
+			Name:            "Hermes",
+			Copyright:       "Copyright © 2025 Hermes. All rights reserved.",
+			TroubleText:     "If you’re having trouble with the button '{ACTION}', copy and paste the URL below into your web browser.",
+			AttachmentsText: "Attached:",
 		},
 	}
 	// Merge the given hermes engine configuration with default one
@@ -332,43 +431,52 @@ func (h *Hermes) GeneratePlainText(email Email) (string, error) {
 		return "", err
 	}
 
-	return html2text.FromString(template, html2text.Options{PrettyTables: true})
+	return toPlainText(template)
 }
 
 func (h *Hermes) generateTemplate(email Email, t *template.Template) (string, error) {
-	err := setDefaultEmailValues(h, &email)
+	return generateTemplate(*h, h.Theme.Styles(), email, t)
+}
+
+// generateTemplate applies the email defaults on top of styles and executes t
+// for h. It is shared by Hermes and Renderer and never modifies its inputs.
+func generateTemplate(h Hermes, styles StylesDefinition, email Email, t *template.Template) (string, error) {
+	email, warnings, err := prepareTemplateEmail(styles, email)
 	if err != nil {
 		return "", err
 	}
+	logWarnings(warnings)
 
-	if len(email.Body.Table.Data) > 0 {
-		logrus.Warn("Email.Body.Table field is deprecated, please use Email.Body.Tables instead")
-		email.Body.Tables = append(email.Body.Tables, email.Body.Table)
-	}
+	return executeTemplate(h, email, t)
+}
 
-	var b bytes.Buffer
-	err = t.Execute(&b, Template{*h, email})
+// prepareTemplateEmail returns the email as given to the templates, along with
+// the warnings raised while preparing it (e.g. usage of deprecated fields)
+func prepareTemplateEmail(styles StylesDefinition, email Email) (Email, []string, error) {
+	err := prepareEmail(styles, &email)
 	if err != nil {
-		return "", err
+		return Email{}, nil, err
 	}
 
-	res := b.String()
-	if h.DisableCSSInlining {
-		return res, nil
+	var warnings []string
+	if len(email.Body.Table.Data) > 0 {
+		warnings = append(warnings, "Email.Body.Table field is deprecated, please use Email.Body.Tables instead")
+		email.Body.Tables = append(slices.Clip(email.Body.Tables), email.Body.Table)
 	}
 
-	// Inlining CSS
-	prem, err := premailer.NewPremailerFromString(res, premailer.NewOptions())
-	if err != nil {
-		return "", err
-	}
+	return email, warnings, nil
+}
 
-	html, err := prem.Transform()
+// executeTemplate executes t with an email already prepared by
+// prepareTemplateEmail and inlines the CSS of the result unless disabled
+func executeTemplate(h Hermes, email Email, t *template.Template) (string, error) {
+	var b strings.Builder
+	warnings, err := writeTemplate(context.Background(), &b, h, email, t)
 	if err != nil {
 		return "", err
 	}
-
-	return html, nil
+	logWarnings(warnings)
+	return b.String(), nil
 }
 
 // TemplateBase returns a base template from which to parse others in
@@ -63,7 +63,7 @@ func (ed SimpleExample) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			Intros: []string{
 				"Welcome to Hermes! We're very excited to have you on board.",
@@ -194,7 +194,7 @@ func (ed SimpleExamplePremailer) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			Intros: []string{
 				"Welcome to Hermes! We're very excited to have you on board.",
@@ -319,7 +319,7 @@ func (ed SimpleExampleUnsafe) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			IntrosUnsafe: []template.HTML{
 				"<b>Welcome to Hermes!</b> We're very excited to have you on board.",
@@ -445,7 +445,7 @@ func (ed SimpleExampleMarkdownIntroOutro) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			IntrosMarkdown: Markdown(strings.Join([]string{
 				`## Welcome to Hermes!`,
@@ -567,7 +567,7 @@ func (ed WithTitleInsteadOfNameExample) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name:  "Jon Snow",
 			Title: "A new e-mail",
 		},
@@ -607,7 +607,7 @@ func (ed WithGreetingDifferentThanDefault) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Greeting: "Dear",
 			Name:     "Jon Snow",
 		},
@@ -641,7 +641,7 @@ func (ed WithSignatureDifferentThanDefault) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name:          "Jon Snow",
 			Signature:     "Best regards",
 			SignatureName: "Test User",
@@ -676,7 +676,7 @@ func (ed WithInviteCode) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			Actions: []Action{
 				{
@@ -715,7 +715,7 @@ func (ed WithFreeMarkdownContent) getExample() (Hermes, Email) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			FreeMarkdown: `
 > _Hermes_ service will shutdown the **1st August 2025** for maintenance operations. 
@@ -929,7 +929,7 @@ func TestHermes_TextDirectionAsDefault(t *testing.T) {
 	}
 
 	email := Email{
-		Body{
+		Body: Body{
 			Name: "Jon Snow",
 			Intros: []string{
 				"Welcome to Hermes! We're very excited to have you on board.",
@@ -1177,6 +1177,52 @@ func TestNormalizeStyles(t *testing.T) {
 	})
 }
 
+func TestMergeCSSWithTheme(t *testing.T) {
+	styles := StylesDefinition{
+		".email-masthead_name": {"text-shadow": nil, "color": Unset, "font-size": "20px"},
+		".button":              {"color": Important("#000000")},
+		"h1":                   {Replace: true, "font-size": "24px"},
+		"cite:before":          nil,
+		".extra":               {"color": Important("red"), "margin": nil},
+	}.MergeCSSWithTheme(new(Default))
+
+	defaults := GetDefaultStyles()
+	assert.Equal(t, map[string]any{"font-size": "20px", "font-weight": "bold", "text-decoration": "none"}, styles[".email-masthead_name"])
+	assert.Equal(t, "#000000 !important", styles[".button"]["color"])
+	assert.Equal(t, defaults[".button"]["background-color"], styles[".button"]["background-color"])
+	assert.Equal(t, map[string]any{"font-size": "24px"}, styles["h1"], "Replaced selectors should only hold the given properties")
+	assert.NotContains(t, styles, "cite:before")
+	assert.Equal(t, map[string]any{"color": "red !important"}, styles[".extra"])
+	assert.Equal(t, defaults, GetDefaultStyles(), "Theme styles should not be modified")
+
+	// The same rules apply to the CSS field and to the css template override
+	for name, body := range map[string]Body{
+		"CSS field": {CSS: StylesDefinition{
+			".email-masthead_name": {"text-shadow": nil},
+			".button":              {"background-color": Important("#ff6600")},
+			"cite:before":          nil,
+		}},
+		"css template override": {TemplateOverrides: map[string]any{"css": map[string]map[string]any{
+			".email-masthead_name": {"text-shadow": Unset},
+			".button":              {"background-color": "#ff6600 !important"},
+			"cite:before":          nil,
+		}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := Hermes{Product: Product{Name: "Hermes"}, DisableCSSInlining: true}
+			body.Actions = extendEmail.Body.Actions
+			html, err := h.GenerateHTML(Email{Body: body})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NotContains(t, html, "text-shadow")
+			assert.Contains(t, html, "background-color: #ff6600 !important;")
+			assert.NotContains(t, html, "cite:before")
+			assert.Contains(t, html, `strokecolor="#ff6600" fillcolor="#ff6600"`, "VML buttons should not get !important")
+		})
+	}
+}
+
 func TestSetDefaultHermesValues(t *testing.T) {
 	t.Run("EmptyHermes", func(t *testing.T) {
 		h := &Hermes{}
@@ -0,0 +1,175 @@
+package hermes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ImageMap is an in-memory set of images, keyed by file name, that can be
+// used as Hermes.Images. It only supports opening and reading its files.
+type ImageMap map[string][]byte
+
+// Open implements fs.FS
+func (m ImageMap) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	data, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &imageFile{Reader: bytes.NewReader(data), name: path.Base(name), size: int64(len(data))}, nil
+}
+
+// ReadFile implements fs.ReadFileFS
+func (m ImageMap) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	data, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data), nil
+}
+
+// imageFile is a file of an ImageMap
+type imageFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+func (f *imageFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *imageFile) Close() error               { return nil }
+func (f *imageFile) Name() string               { return f.name }
+func (f *imageFile) Size() int64                { return f.size }
+func (f *imageFile) Mode() fs.FileMode          { return 0444 }
+func (f *imageFile) ModTime() time.Time         { return time.Time{} }
+func (f *imageFile) IsDir() bool                { return false }
+func (f *imageFile) Sys() any                   { return nil }
+
+var imgSrcRE = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*)("[^"]*"|'[^']*')`)
+
+// embedImages replaces the sources of the <img> elements naming a file of
+// fsys by cid: URLs, and returns the images to attach to the message. Remote
+// (http:, data:...) and unknown sources are left untouched.
+func embedImages(body string, fsys fs.FS, domain string) (string, []filePart, error) {
+	if fsys == nil {
+		return body, nil, nil
+	}
+
+	var images []filePart
+	byName := map[string]string{}
+	var err error
+	body = imgSrcRE.ReplaceAllStringFunc(body, func(tag string) string {
+		m := imgSrcRE.FindStringSubmatch(tag)
+		quoted := m[2]
+		name, ok := imageName(html.UnescapeString(quoted[1 : len(quoted)-1]))
+		if !ok || err != nil {
+			return tag
+		}
+		cid, found := byName[name]
+		if !found {
+			data, readErr := fs.ReadFile(fsys, name)
+			if errors.Is(readErr, fs.ErrNotExist) {
+				return tag
+			}
+			if readErr != nil {
+				err = readErr
+				return tag
+			}
+			sum := sha256.Sum256([]byte(name))
+			cid = hex.EncodeToString(sum[:8]) + "@" + domain
+			byName[name] = cid
+			images = append(images, filePart{
+				name:        name,
+				contentType: fileContentType(name, data),
+				contentID:   cid,
+				disposition: DispositionInline,
+				data:        data,
+			})
+		}
+		return m[1] + `"cid:` + cid + `"`
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return body, images, nil
+}
+
+// imageName returns the file name referenced by an image source, if it is a
+// local path and not an URL
+func imageName(src string) (string, bool) {
+	src = strings.TrimSpace(src)
+	if src == "" || strings.HasPrefix(src, "//") || strings.Contains(src, ":") {
+		return "", false
+	}
+	name := strings.TrimPrefix(path.Clean("/"+src), "/")
+	return name, fs.ValidPath(name)
+}
+
+// blockImages returns the images of blocks, and of the blocks they hold,
+// given with their content, by file name. Blocks may be pointers.
+func blockImages(blocks Blocks) ImageMap {
+	images := ImageMap{}
+	var add func(Block)
+	add = func(b Block) {
+		switch b := b.(type) {
+		case ImageBlock:
+			if name, ok := imageName(b.Src); ok && len(b.Data) > 0 {
+				images[name] = b.Data
+			}
+		case CardBlock:
+			add(b.Image)
+		case ColumnsBlock:
+			for _, column := range b.Columns {
+				for _, c := range column {
+					add(c)
+				}
+			}
+		case *ImageBlock:
+			if b != nil {
+				add(*b)
+			}
+		case *CardBlock:
+			if b != nil {
+				add(*b)
+			}
+		case *ColumnsBlock:
+			if b != nil {
+				add(*b)
+			}
+		}
+	}
+	for _, b := range blocks {
+		add(b)
+	}
+	return images
+}
+
+// imageLayers is a file system made of the files of several ones, the first
+// providing a file hiding the others
+type imageLayers []fs.FS
+
+// Open implements fs.FS
+func (l imageLayers) Open(name string) (fs.File, error) {
+	for _, fsys := range l {
+		if fsys == nil {
+			continue
+		}
+		f, err := fsys.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
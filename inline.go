@@ -0,0 +1,240 @@
+package hermes
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/vanng822/go-premailer/premailer"
+	"golang.org/x/net/html"
+)
+
+// Inliner inlines the CSS of the <style> elements of an HTML email into the
+// style attributes of its elements, for the email clients ignoring <style>
+// elements. The rules which cannot be inlined, e.g. @media, must be kept in a
+// <style> element, so that the email stays responsive. <style> elements with
+// a data-premailer="ignore" attribute must be left as they are.
+type Inliner interface {
+	// Inline inlines the CSS of doc and returns the resulting HTML
+	Inline(doc *goquery.Document) (string, error)
+}
+
+// PremailerInliner inlines CSS with premailer (github.com/vanng822/go-premailer).
+// It is the default inliner.
+type PremailerInliner struct {
+	RemoveClasses          bool // Remove the class attribute of the elements CSS is inlined into
+	KeepBangImportant      bool // Keep !important in the style attributes
+	DisableCSSToAttributes bool // Do not copy the width and height properties into HTML attributes
+	// KeepStyles keeps the <style> elements as they are, besides inlining them,
+	// for the email clients supporting them, instead of the copy of the rules
+	// which cannot be inlined premailer adds. The rules of media queries must
+	// then be !important to win over the inlined styles.
+	KeepStyles bool
+}
+
+// Inline inlines the CSS of doc with premailer
+func (in PremailerInliner) Inline(doc *goquery.Document) (string, error) {
+	opts := premailer.NewOptions()
+	opts.RemoveClasses = in.RemoveClasses
+	opts.KeepBangImportant = in.KeepBangImportant
+	opts.CssToAttributes = !in.DisableCSSToAttributes
+	if !in.KeepStyles {
+		return premailer.NewPremailer(doc, opts).Transform()
+	}
+
+	restore := keepStyles(doc)
+	styles := doc.Find("style")
+	if _, err := premailer.NewPremailer(doc, opts).Transform(); err != nil {
+		return "", err
+	}
+	// The rules which cannot be inlined are among the kept styles already
+	doc.Find("style").NotSelection(styles).Remove()
+	restore()
+	return doc.Html()
+}
+
+// FastInliner is an inliner matching the selectors of the CSS with the
+// selector engine of goquery (cascadia), without copying CSS properties into
+// HTML attributes. The declarations are applied in the order of the cascade:
+// by importance, origin (the style attribute winning over the <style>
+// elements), specificity and order.
+type FastInliner struct {
+	RemoveClasses     bool // Remove the class attribute of the elements CSS is inlined into
+	KeepBangImportant bool // Keep !important in the style attributes
+	// KeepStyles keeps the <style> elements as they are, besides inlining them,
+	// for the email clients supporting them. The rules which cannot be inlined
+	// are kept anyway, marked !important.
+	KeepStyles bool
+}
+
+// notInlinableRE matches the selectors which cannot be inlined, e.g. :hover
+// or ::before, or should not be (*)
+var notInlinableRE = regexp.MustCompile(`(?i):(visited|active|hover|focus|focus-within|focus-visible|link|root|in-range|out-of-range|invalid|valid|after|before|selection|target|checked|disabled|enabled|lang|placeholder|marker|first-line|first-letter)\b|\*`)
+
+// inlinedDeclaration is a declaration of a rule matching an element, or of
+// its style attribute
+type inlinedDeclaration struct {
+	Declaration
+	inline      bool
+	specificity cascadia.Specificity
+	order       int
+}
+
+// Inline inlines the CSS of doc
+func (in FastInliner) Inline(doc *goquery.Document) (string, error) {
+	restore := func() {}
+	if in.KeepStyles {
+		restore = keepStyles(doc)
+	}
+
+	var leftover Stylesheet
+	matched := map[*html.Node][]inlinedDeclaration{}
+	var elements []*html.Node
+	order := 0
+	doc.Find("style").Each(func(_ int, s *goquery.Selection) {
+		if ignored(s) {
+			return
+		}
+		for _, r := range ParseStylesheet(s.Text()) {
+			if r.IsAtRule() {
+				leftover = append(leftover, r)
+				continue
+			}
+			for _, sel := range splitSelectors(r.Selector) {
+				compiled, err := cascadia.Parse(sel)
+				if err != nil || notInlinableRE.MatchString(sel) {
+					leftover = append(leftover, Rule{Selector: sel, Declarations: slices.Clone(r.Declarations)})
+					continue
+				}
+				for _, n := range cascadia.QueryAll(doc.Nodes[0], compiled) {
+					if matched[n] == nil {
+						elements = append(elements, n)
+					}
+					for _, d := range r.Declarations {
+						matched[n] = append(matched[n], inlinedDeclaration{Declaration: d, specificity: compiled.Specificity(), order: order})
+						order++
+					}
+				}
+			}
+		}
+		s.Remove()
+	})
+
+	for _, n := range elements {
+		in.inline(doc.FindNodes(n), matched[n])
+	}
+
+	if len(leftover) > 0 {
+		// The rules left must win over the style attributes, e.g. in media queries
+		for i := range leftover {
+			leftover[i] = importantRule(leftover[i])
+		}
+		style := &html.Node{Type: html.ElementNode, Data: "style", Attr: []html.Attribute{{Key: "type", Val: "text/css"}}}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: leftover.String()})
+		doc.Find("head").AppendNodes(style)
+	}
+	restore()
+	return doc.Html()
+}
+
+// inline sets the style attribute of the element s with the declarations
+// matching it, in the order of the cascade
+func (in FastInliner) inline(s *goquery.Selection, decls []inlinedDeclaration) {
+	for i, d := range parseDeclarations(s.AttrOr("style", "")) {
+		decls = append(decls, inlinedDeclaration{Declaration: d, inline: true, order: i})
+	}
+	slices.SortStableFunc(decls, func(a, b inlinedDeclaration) int {
+		switch {
+		case a.Important != b.Important:
+			return compareBool(a.Important, b.Important)
+		case a.inline != b.inline:
+			return compareBool(a.inline, b.inline)
+		case a.specificity.Less(b.specificity):
+			return -1
+		case b.specificity.Less(a.specificity):
+			return 1
+		}
+		return a.order - b.order
+	})
+
+	// Each property is set once, with its last value, at its first position
+	var properties []string
+	values := map[string]Declaration{}
+	for _, d := range decls {
+		if _, ok := values[d.Property]; !ok {
+			properties = append(properties, d.Property)
+		}
+		values[d.Property] = d.Declaration
+	}
+	style := make([]string, len(properties))
+	for i, p := range properties {
+		d := values[p]
+		d.Important = d.Important && in.KeepBangImportant
+		style[i] = strings.Replace(d.String(), ": ", ":", 1)
+	}
+	if len(style) > 0 {
+		s.SetAttr("style", strings.Join(style, ";"))
+	}
+	if in.RemoveClasses {
+		s.RemoveAttr("class")
+	}
+}
+
+// compareBool orders false before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// importantRule returns r with its declarations, and the ones of its nested
+// rules, marked !important
+func importantRule(r Rule) Rule {
+	for i := range r.Declarations {
+		r.Declarations[i].Important = true
+	}
+	for i := range r.Rules {
+		r.Rules[i] = importantRule(r.Rules[i])
+	}
+	return r
+}
+
+// keepStyles inserts copies of the <style> elements of doc to be inlined
+// before them, ignored by the inliners. The returned function makes the
+// copies regular <style> elements again, once the CSS inlined.
+func keepStyles(doc *goquery.Document) func() {
+	var kept []*html.Node
+	doc.Find("style").Each(func(_ int, s *goquery.Selection) {
+		if ignored(s) {
+			return
+		}
+		n := s.Nodes[0]
+		keep := &html.Node{Type: n.Type, Data: n.Data, DataAtom: n.DataAtom, Attr: append(slices.Clip(n.Attr), html.Attribute{Key: "data-premailer", Val: "ignore"})}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			keep.AppendChild(&html.Node{Type: c.Type, Data: c.Data})
+		}
+		n.Parent.InsertBefore(keep, n)
+		kept = append(kept, keep)
+	})
+	return func() {
+		for _, n := range kept {
+			n.Attr = n.Attr[:len(n.Attr)-1]
+		}
+	}
+}
+
+// ignored tells whether the <style> element s must not be inlined, as
+// premailer does
+func ignored(s *goquery.Selection) bool {
+	if s.AttrOr("data-premailer", "") == "ignore" {
+		return true
+	}
+	media, ok := s.Attr("media")
+	return ok && media != "all"
+}
@@ -0,0 +1,126 @@
+package hermes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+const inlinerHTML = `<html><head>
+<style type="text/css">
+p { color: red; margin: 0; }
+.intro { color: blue; }
+p { color: green; }
+#lead { font-size: 18px !important; }
+td { background-color: #eeeeee; width: 120px; }
+.cell { color: #333333 !important; }
+a:hover { color: black; }
+* { box-sizing: border-box; }
+@media only screen and (max-width: 500px) { .intro { font-size: 12px; } }
+</style>
+<style data-premailer="ignore">p { color: orange; }</style>
+</head><body>
+<p class="intro" id="lead" style="font-size: 14px; padding: 0">Hi</p>
+<table><tr><td class="cell">Cell</td></tr></table>
+<a href="#">Link</a>
+</body></html>`
+
+func inline(t *testing.T, in Inliner) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(inlinerHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := in.Inline(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestFastInliner(t *testing.T) {
+	doc := inline(t, FastInliner{})
+	p := doc.Find("p")
+	assert.Equal(t, "color:blue;margin:0;font-size:18px;padding:0", p.AttrOr("style", ""),
+		"Declarations should follow the cascade: importance, style attribute, specificity and order")
+	assert.Equal(t, "intro", p.AttrOr("class", ""))
+	assert.Equal(t, "background-color:#eeeeee;width:120px;color:#333333", doc.Find("td").AttrOr("style", ""))
+	assert.False(t, doc.Find("td").Is("[width]"), "CSS properties should not be copied into attributes")
+	assert.False(t, doc.Find("a").Is("[style]"))
+
+	styles := doc.Find("style")
+	if assert.Equal(t, 2, styles.Length()) {
+		assert.Equal(t, "p { color: orange; }", styles.First().Text(), "Ignored styles should be left as they are")
+		assert.Equal(t, `a:hover {
+  color: black !important;
+}
+
+* {
+  box-sizing: border-box !important;
+}
+
+@media only screen and (max-width: 500px) {
+  .intro {
+    font-size: 12px !important;
+  }
+}
+`, styles.Last().Text(), "Rules which cannot be inlined should be kept")
+	}
+
+	doc = inline(t, FastInliner{RemoveClasses: true, KeepBangImportant: true, KeepStyles: true})
+	p = doc.Find("p")
+	assert.Equal(t, "color:blue;margin:0;font-size:18px !important;padding:0", p.AttrOr("style", ""))
+	assert.False(t, p.Is("[class]"))
+	styles = doc.Find("style")
+	if assert.Equal(t, 3, styles.Length()) {
+		assert.Contains(t, styles.First().Text(), ".intro { color: blue; }")
+		assert.False(t, styles.First().Is("[data-premailer]"), "Kept styles should not be marked as ignored")
+		assert.Contains(t, styles.Last().Text(), "font-size: 12px !important;")
+	}
+}
+
+func TestPremailerInliner(t *testing.T) {
+	doc := inline(t, PremailerInliner{})
+	assert.Equal(t, "120", doc.Find("td").AttrOr("width", ""))
+	assert.Equal(t, "intro", doc.Find("p").AttrOr("class", ""))
+	assert.Equal(t, 2, doc.Find("style").Length())
+	assert.Contains(t, doc.Find("style").Last().Text(), "@media only screen and (max-width: 500px)")
+
+	doc = inline(t, PremailerInliner{RemoveClasses: true, KeepBangImportant: true, DisableCSSToAttributes: true, KeepStyles: true})
+	p := doc.Find("p")
+	assert.False(t, p.Is("[class]"))
+	assert.Contains(t, doc.Find("td").AttrOr("style", ""), "color:#333333 !important")
+	assert.False(t, doc.Find("td").Is("[width]"))
+	styles := doc.Find("style")
+	if assert.Equal(t, 2, styles.Length(), "The rules which cannot be inlined should not be added to the kept styles") {
+		assert.Contains(t, styles.First().Text(), ".intro { color: blue; }")
+		assert.False(t, styles.First().Is("[data-premailer]"))
+		assert.Equal(t, 1, strings.Count(doc.Text(), "@media only screen and (max-width: 500px)"))
+		assert.Equal(t, "p { color: orange; }", styles.Last().Text())
+	}
+}
+
+func TestHermes_Inliner(t *testing.T) {
+	for _, in := range []Inliner{nil, PremailerInliner{}, FastInliner{}} {
+		h := Hermes{Product: Product{Name: "Hermes"}, Inliner: in}
+		html, err := h.GenerateHTML(extendEmail)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Contains(t, html, `class="button" style="`)
+		assert.Contains(t, html, "@media only screen and (max-width: 500px)", "Responsive rules should be kept")
+		assert.NotContains(t, html, "<style type=\"text/css\" rel=\"stylesheet\"", "Inlined styles should be removed")
+	}
+
+	h := Hermes{Product: Product{Name: "Hermes"}, Inliner: FastInliner{}, DisableCSSInlining: true}
+	html, err := h.GenerateHTML(extendEmail)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, html, `class="button" style="`, "The inliner should not run when inlining is disabled")
+	}
+}
@@ -0,0 +1,462 @@
+package hermes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrEmptySender is returned when building a message without From address
+	ErrEmptySender = errors.New("message sender is empty")
+	// ErrNoRecipients is returned when building a message without any To, Cc or Bcc address
+	ErrNoRecipients = errors.New("message has no recipients")
+	// ErrInvalidHeader is returned when a custom header has an invalid name or value,
+	// or when it would replace a header managed by hermes
+	ErrInvalidHeader = errors.New("invalid message header")
+	// ErrUnnamedAttachment is returned when building a message with an attachment without name
+	ErrUnnamedAttachment = errors.New("attachment has no name")
+)
+
+// maxHeaderLineLength is the length after which header lines are folded (RFC 5322 section 2.1.1)
+const maxHeaderLineLength = 78
+
+// maxLineLength is the length header lines must not exceed (RFC 5322 section 2.1.1)
+const maxLineLength = 998
+
+// reservedHeaders are the headers written by hermes that cannot be set as custom headers.
+// Date and Message-ID are generated, but can be overridden.
+var reservedHeaders = []string{
+	"Bcc", "Cc", "Content-Transfer-Encoding", "Content-Type", "From", "Mime-Version", "Reply-To", "Subject", "To",
+}
+
+// Envelope holds the addressing information of a message.
+// Addresses are RFC 5322 addresses, e.g. "Jon Snow <jon@example.com>" or "jon@example.com".
+type Envelope struct {
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string // Bcc recipients receive the message, but are not written in its headers
+	ReplyTo []string
+	Subject string            // Subject of the message (default to the subject of the email)
+	Headers map[string]string // Custom headers, e.g. List-Unsubscribe (may override Date and Message-ID)
+}
+
+// Message is a complete RFC 5322 message, ready to be handed to a mail transport
+type Message struct {
+	id         string
+	from       string
+	recipients []string
+	raw        []byte
+}
+
+// MessageID returns the Message-ID header of the message, angle brackets included
+func (m *Message) MessageID() string {
+	return m.id
+}
+
+// From returns the address of the sender, without display name
+func (m *Message) From() string {
+	return m.from
+}
+
+// Recipients returns the addresses of all To, Cc and Bcc recipients, without display names
+func (m *Message) Recipients() []string {
+	return slices.Clone(m.recipients)
+}
+
+// Bytes returns the encoded message
+func (m *Message) Bytes() []byte {
+	return bytes.Clone(m.raw)
+}
+
+// WriteTo writes the encoded message to w
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m.raw)
+	return int64(n), err
+}
+
+// NewMessage returns the message encoded in raw, delivered from the sender to
+// the recipients (bare addresses), e.g. to send again a message read from disk
+func NewMessage(from string, recipients []string, raw []byte) (*Message, error) {
+	if strings.TrimSpace(from) == "" {
+		return nil, ErrEmptySender
+	}
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &Message{
+		id:         m.Header.Get("Message-Id"),
+		from:       from,
+		recipients: slices.Clone(recipients),
+		raw:        bytes.Clone(raw),
+	}, nil
+}
+
+// BuildMessage renders the email and assembles it as a multipart/alternative
+// message with a plain text and an HTML part, along with its attachments
+func (h *Hermes) BuildMessage(env Envelope, email Email) (*Message, error) {
+	err := setDefaultHermesValues(h)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(*h)
+	if err != nil {
+		return nil, err
+	}
+	return r.BuildMessage(context.Background(), env, email)
+}
+
+// BuildMessage renders the email and assembles it as a multipart/alternative
+// message with a plain text and an HTML part. Both parts are quoted-printable
+// encoded, header values are RFC 2047 encoded when needed and a Message-ID is
+// generated from the domain of the sender. Images of Hermes.Images, or of
+// image blocks given with their content, referenced by the HTML body are
+// embedded as multipart/related inline parts, as are inline attachments with
+// a Content-ID. Other attachments are added as multipart/mixed parts.
+func (r *Renderer) BuildMessage(ctx context.Context, env Envelope, email Email) (*Message, error) {
+	res, err := r.Render(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if env.Subject == "" {
+		env.Subject = res.Subject
+	}
+	fsys := r.hermes.Images
+	if images := blockImages(email.Body.Blocks); len(images) > 0 {
+		fsys = imageLayers{images, fsys}
+	}
+	return buildMessage(env, res, fsys, email.Attachments)
+}
+
+// buildMessage assembles the rendered email with its attachments, embedding
+// the images of fsys referenced by its HTML body
+func buildMessage(env Envelope, res *Rendered, fsys fs.FS, attachments []Attachment) (*Message, error) {
+	if strings.TrimSpace(env.From) == "" {
+		return nil, ErrEmptySender
+	}
+	from, err := mail.ParseAddress(env.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", env.From, err)
+	}
+	to, err := parseAddressList(env.To)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := parseAddressList(env.Cc)
+	if err != nil {
+		return nil, err
+	}
+	bcc, err := parseAddressList(env.Bcc)
+	if err != nil {
+		return nil, err
+	}
+	replyTo, err := parseAddressList(env.ReplyTo)
+	if err != nil {
+		return nil, err
+	}
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	custom := textproto.MIMEHeader{}
+	for name, value := range env.Headers {
+		if err := checkHeader(name, value); err != nil {
+			return nil, err
+		}
+		custom.Set(name, value)
+	}
+
+	m := &Message{from: from.Address}
+	for _, list := range [][]*mail.Address{to, cc, bcc} {
+		for _, a := range list {
+			m.recipients = append(m.recipients, a.Address)
+		}
+	}
+	m.id = custom.Get("Message-Id")
+	if m.id == "" {
+		m.id, err = generateMessageID(addressDomain(from.Address))
+		if err != nil {
+			return nil, err
+		}
+	}
+	htmlBody, related, err := embedImages(res.HTML, fsys, addressDomain(from.Address))
+	if err != nil {
+		return nil, err
+	}
+	inline, attached, err := attachmentParts(attachments)
+	if err != nil {
+		return nil, err
+	}
+	related = append(related, inline...)
+	date := custom.Get("Date")
+	if date == "" {
+		date = time.Now().Format(time.RFC1123Z)
+	}
+	custom.Del("Message-Id")
+	custom.Del("Date")
+
+	var b bytes.Buffer
+	fields := [][2]string{
+		{"From", formatAddressList([]*mail.Address{from})},
+		{"To", formatAddressList(to)},
+		{"Cc", formatAddressList(cc)},
+		{"Reply-To", formatAddressList(replyTo)},
+		{"Subject", mime.QEncoding.Encode("utf-8", env.Subject)},
+		{"Date", date},
+		{"Message-ID", m.id},
+		{"MIME-Version", "1.0"},
+	}
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fields = append(fields, [2]string{name, mime.QEncoding.Encode("utf-8", custom.Get(name))})
+	}
+	for _, field := range fields {
+		if err = writeHeader(&b, field[0], field[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	// The message is a multipart/mixed of its content and attached files, its
+	// content a multipart/related of the bodies and the files they reference
+	alternative := func(create partCreator) error {
+		return writeMultipart(create, "multipart/alternative", nil, func(create partCreator) error {
+			err := writeText(create, "text/plain; charset=utf-8", res.Text)
+			if err != nil {
+				return err
+			}
+			return writeText(create, "text/html; charset=utf-8", htmlBody)
+		})
+	}
+	content := alternative
+	if len(related) > 0 {
+		// Inline files are related to the HTML body (RFC 2387)
+		content = func(create partCreator) error {
+			return writeMultipart(create, "multipart/related", map[string]string{"type": "multipart/alternative"}, func(create partCreator) error {
+				err := alternative(create)
+				if err != nil {
+					return err
+				}
+				return writeFiles(create, related)
+			})
+		}
+	}
+	if len(attached) > 0 {
+		err = writeMultipart(messageBody(&b), "multipart/mixed", nil, func(create partCreator) error {
+			err := content(create)
+			if err != nil {
+				return err
+			}
+			return writeFiles(create, attached)
+		})
+	} else {
+		err = content(messageBody(&b))
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.raw = b.Bytes()
+	return m, nil
+}
+
+// partCreator creates a MIME entity with the given header and returns the
+// writer of its body. multipart.Writer.CreatePart is a partCreator.
+type partCreator func(header textproto.MIMEHeader) (io.Writer, error)
+
+// messageBody returns a partCreator writing the header of the entity as the
+// last fields of the message header, followed by the message body
+func messageBody(b *bytes.Buffer) partCreator {
+	return func(header textproto.MIMEHeader) (io.Writer, error) {
+		names := make([]string, 0, len(header))
+		for name := range header {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if err := writeHeader(b, name, header.Get(name)); err != nil {
+				return nil, err
+			}
+		}
+		b.WriteString("\r\n")
+		return b, nil
+	}
+}
+
+// writeMultipart writes a multipart entity of the given media type, whose parts are written by parts
+func writeMultipart(create partCreator, mediaType string, params map[string]string, parts func(create partCreator) error) error {
+	boundary := multipart.NewWriter(nil).Boundary()
+	params = maps.Clone(params)
+	if params == nil {
+		params = map[string]string{}
+	}
+	params["boundary"] = boundary
+	w, err := create(textproto.MIMEHeader{"Content-Type": {mime.FormatMediaType(mediaType, params)}})
+	if err != nil {
+		return err
+	}
+	mw := multipart.NewWriter(w)
+	if err = mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	if err = parts(mw.CreatePart); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// writeText writes a quoted-printable encoded text entity
+func writeText(create partCreator, contentType, content string) error {
+	w, err := create(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(w)
+	if _, err = io.WriteString(qp, content); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeFiles writes base64 encoded file entities
+func writeFiles(create partCreator, files []filePart) error {
+	for _, f := range files {
+		header := textproto.MIMEHeader{
+			"Content-Type":        {f.contentType},
+			"Content-Disposition": {mime.FormatMediaType(string(f.disposition), map[string]string{"filename": path.Base(f.name)})},
+		}
+		if f.contentID != "" {
+			header["Content-ID"] = []string{"<" + f.contentID + ">"}
+		}
+		err := writeBase64(create, header, f.data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// base64LineLength is the maximum length of base64 encoded lines (RFC 2045 section 6.8)
+const base64LineLength = 76
+
+// writeBase64 writes a base64 encoded entity with the given header
+func writeBase64(create partCreator, header textproto.MIMEHeader, data []byte) error {
+	header.Set("Content-Transfer-Encoding", "base64")
+	w, err := create(header)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := min(len(encoded), base64LineLength)
+		if _, err = io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+func parseAddressList(list []string) ([]*mail.Address, error) {
+	addresses := make([]*mail.Address, 0, len(list))
+	for _, s := range list {
+		a, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", s, err)
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, nil
+}
+
+// formatAddressList formats addresses for a header, encoding display names when needed
+func formatAddressList(addresses []*mail.Address) string {
+	formatted := make([]string, len(addresses))
+	for i, a := range addresses {
+		formatted[i] = a.String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// checkHeader checks that a custom header can be safely written to the message
+func checkHeader(name, value string) error {
+	if name == "" || strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) {
+		return fmt.Errorf("%w: name %q", ErrInvalidHeader, name)
+	}
+	if slices.Contains(reservedHeaders, textproto.CanonicalMIMEHeaderKey(name)) {
+		return fmt.Errorf("%w: %q is set by hermes", ErrInvalidHeader, name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%w: value of %q contains a line break", ErrInvalidHeader, name)
+	}
+	return nil
+}
+
+// writeHeader writes a header field, folding it on spaces so that lines stay
+// under maxHeaderLineLength when possible. Empty values are skipped. It fails
+// with ErrInvalidHeader when a line would exceed maxLineLength.
+func writeHeader(b *bytes.Buffer, name, value string) error {
+	if value == "" {
+		return nil
+	}
+	lineLength := len(name) + 1
+	b.WriteString(name)
+	b.WriteString(":")
+	for i, word := range strings.Split(value, " ") {
+		if i > 0 && lineLength+1+len(word) > maxHeaderLineLength {
+			b.WriteString("\r\n")
+			lineLength = 0
+		}
+		if lineLength+1+len(word) > maxLineLength {
+			return fmt.Errorf("%w: %s has a line longer than %d characters", ErrInvalidHeader, name, maxLineLength)
+		}
+		b.WriteString(" ")
+		b.WriteString(word)
+		lineLength += 1 + len(word)
+	}
+	b.WriteString("\r\n")
+	return nil
+}
+
+// addressDomain returns the domain of an email address
+func addressDomain(address string) string {
+	if at := strings.LastIndex(address, "@"); at != -1 && at < len(address)-1 {
+		return address[at+1:]
+	}
+	return "localhost"
+}
+
+// generateMessageID returns a unique Message-ID for the given domain
+func generateMessageID(domain string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(id), domain), nil
+}
@@ -0,0 +1,372 @@
+package hermes
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// messagePart is a decoded leaf part of a message
+type messagePart struct {
+	header  textproto.MIMEHeader
+	content string
+}
+
+// readParts parses a built message and returns its header and decoded parts by content type
+func readParts(t *testing.T, raw []byte) (mail.Header, map[string]string) {
+	t.Helper()
+	header, leaves := readMessage(t, raw)
+	parts := map[string]string{}
+	for _, p := range leaves {
+		// Text parts use CRLF line endings once encoded
+		parts[p.header.Get("Content-Type")] = strings.ReplaceAll(p.content, "\r\n", "\n")
+	}
+	return header, parts
+}
+
+// readMessage parses a built message and returns its header and decoded leaf parts,
+// walking nested multipart entities
+func readMessage(t *testing.T, raw []byte) (mail.Header, []messagePart) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return msg.Header, readEntity(t, textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+func readEntity(t *testing.T, header textproto.MIMEHeader, body io.Reader) []messagePart {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		content, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		if header.Get("Content-Transfer-Encoding") == "base64" {
+			content, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(content), "\r\n", ""))
+			assert.NoError(t, err)
+		}
+		return []messagePart{{header, string(content)}}
+	}
+
+	var parts []messagePart
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		parts = append(parts, readEntity(t, p.Header, p)...)
+	}
+	return parts
+}
+
+func TestBuildMessage(t *testing.T) {
+	h, email := SimpleExample{new(Default)}.getExample()
+	email.Body.Title = "Bienvenue à bord"
+	env := Envelope{
+		From:    "Hermès <no-reply@example.com>",
+		To:      []string{"Jon Snow <jon@example.com>"},
+		Cc:      []string{"arya@example.com"},
+		Bcc:     []string{"audit@example.com"},
+		ReplyTo: []string{"support@example.com"},
+		Headers: map[string]string{"X-Campaign": "welcome"},
+	}
+
+	m, err := h.BuildMessage(env, email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "no-reply@example.com", m.From())
+	assert.Equal(t, []string{"jon@example.com", "arya@example.com", "audit@example.com"}, m.Recipients())
+	assert.True(t, strings.HasPrefix(m.MessageID(), "<"))
+	assert.True(t, strings.HasSuffix(m.MessageID(), "@example.com>"))
+
+	raw := m.Bytes()
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998)
+		assert.NotContains(t, line, "\n", "Lines should end with CRLF")
+	}
+
+	header, parts := readParts(t, raw)
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bienvenue à bord", subject)
+	from, err := header.AddressList("From")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hermès", from[0].Name)
+	assert.Equal(t, "1.0", header.Get("MIME-Version"))
+	assert.Equal(t, m.MessageID(), header.Get("Message-ID"))
+	assert.NotEmpty(t, header.Get("Date"))
+	assert.Equal(t, "welcome", header.Get("X-Campaign"))
+	assert.Equal(t, "<support@example.com>", header.Get("Reply-To"))
+	assert.Empty(t, header.Get("Bcc"))
+
+	html, err := h.GenerateHTML(email)
+	assert.NoError(t, err)
+	text, err := h.GeneratePlainText(email)
+	assert.NoError(t, err)
+	assert.Equal(t, html, parts["text/html; charset=utf-8"])
+	assert.Equal(t, text, parts["text/plain; charset=utf-8"])
+
+	// WriteTo writes the same bytes
+	var b bytes.Buffer
+	n, err := m.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(raw)), n)
+	assert.Equal(t, raw, b.Bytes())
+}
+
+func TestBuildMessage_Headers(t *testing.T) {
+	r, err := New(Hermes{DisableCSSInlining: true})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("ExplicitSubjectAndOverrides", func(t *testing.T) {
+		m, err := r.BuildMessage(ctx, Envelope{
+			From:    "no-reply@example.com",
+			To:      []string{"jon@example.com"},
+			Subject: strings.Repeat("A very long subject ", 10),
+			Headers: map[string]string{"message-id": "<fixed@example.com>", "Date": "Mon, 02 Jan 2006 15:04:05 -0700"},
+		}, Email{Subject: "ignored"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "<fixed@example.com>", m.MessageID())
+		for _, line := range strings.Split(string(m.Bytes()), "\r\n") {
+			assert.LessOrEqual(t, len(line), maxHeaderLineLength)
+		}
+		header, _ := readParts(t, m.Bytes())
+		assert.Equal(t, strings.TrimSpace(strings.Repeat("A very long subject ", 10)), header.Get("Subject"))
+		assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 -0700", header.Get("Date"))
+		assert.Equal(t, "<fixed@example.com>", header.Get("Message-Id"))
+	})
+
+	t.Run("LongWords", func(t *testing.T) {
+		unsubscribe := "<https://example.com/unsubscribe?token=" + strings.Repeat("0123456789", 20) + ">, <mailto:unsubscribe@example.com?subject=unsubscribe>"
+		m, err := r.BuildMessage(ctx, Envelope{
+			From:    "no-reply@example.com",
+			To:      []string{"jon@example.com"},
+			Subject: "Your token: " + strings.Repeat("0123456789", 20),
+			Headers: map[string]string{"List-Unsubscribe": unsubscribe},
+		}, Email{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Contains(t, string(m.Bytes()), "\r\nList-Unsubscribe: <https://example.com/unsubscribe?token="+strings.Repeat("0123456789", 20)+">,\r\n <mailto:", "Long values should only be folded at whitespace")
+		header, _ := readParts(t, m.Bytes())
+		assert.Equal(t, unsubscribe, header.Get("List-Unsubscribe"))
+		assert.Equal(t, "Your token: "+strings.Repeat("0123456789", 20), header.Get("Subject"))
+
+		// Lines that cannot be folded under the hard limit are rejected
+		_, err = r.BuildMessage(ctx, Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}, Headers: map[string]string{"X-Token": strings.Repeat("0123456789", 100)}}, Email{})
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+		_, err = r.BuildMessage(ctx, Envelope{From: "no-reply@example.com", To: []string{strings.Repeat("a", 1000) + "@example.com"}}, Email{})
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := []struct {
+			name string
+			env  Envelope
+			err  error
+		}{
+			{"EmptySender", Envelope{To: []string{"jon@example.com"}}, ErrEmptySender},
+			{"NoRecipients", Envelope{From: "no-reply@example.com"}, ErrNoRecipients},
+			{"ReservedHeader", Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}, Headers: map[string]string{"content-type": "text/plain"}}, ErrInvalidHeader},
+			{"InvalidHeaderName", Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}, Headers: map[string]string{"X Bad": "value"}}, ErrInvalidHeader},
+			{"HeaderInjection", Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}, Headers: map[string]string{"X-Bad": "value\r\nBcc: evil@example.com"}}, ErrInvalidHeader},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				m, err := r.BuildMessage(ctx, tt.env, Email{})
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, m)
+			})
+		}
+
+		_, err := r.BuildMessage(ctx, Envelope{From: "not an address", To: []string{"jon@example.com"}}, Email{})
+		assert.ErrorContains(t, err, "invalid sender")
+		_, err = r.BuildMessage(ctx, Envelope{From: "no-reply@example.com", To: []string{"jon"}}, Email{})
+		assert.ErrorContains(t, err, "invalid address")
+	})
+}
+
+func TestBuildMessage_InlineImages(t *testing.T) {
+	logo := []byte("\x89PNG\r\n\x1a\nlogo")
+	photo := []byte("GIF89a photo")
+	h := Hermes{
+		Product: Product{Name: "Hermes", Logo: "images/logo.png"},
+		Images:  ImageMap{"images/logo.png": logo, "photo": photo},
+	}
+	email := Email{Body: Body{
+		Name: "Jon Snow",
+		IntrosUnsafe: []template.HTML{
+			`<img src="./photo" alt="photo"> <img src='/images/logo.png'>`,
+			`<img src="https://example.com/remote.png"> <img src="missing.png">`,
+		},
+	}}
+
+	m, err := h.BuildMessage(Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}}, email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	header, parts := readMessage(t, m.Bytes())
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/related", mediaType)
+	assert.Equal(t, "multipart/alternative", params["type"])
+	if !assert.Len(t, parts, 4) {
+		return
+	}
+
+	html := parts[1].content
+	assert.NotContains(t, html, "images/logo.png")
+	assert.NotContains(t, html, "./photo")
+	assert.Contains(t, html, "https://example.com/remote.png")
+	assert.Contains(t, html, "missing.png")
+
+	logoPart, photoPart := parts[2], parts[3]
+	assert.Equal(t, "image/png", logoPart.header.Get("Content-Type"))
+	assert.Equal(t, string(logo), logoPart.content)
+	assert.Equal(t, `inline; filename=logo.png`, logoPart.header.Get("Content-Disposition"))
+	assert.Equal(t, "image/gif", photoPart.header.Get("Content-Type"))
+	assert.Equal(t, string(photo), photoPart.content)
+	// The logo is used twice, but embedded once
+	for p, uses := range map[*messagePart]int{&logoPart: 2, &photoPart: 1} {
+		cid := strings.Trim(p.header.Get("Content-Id"), "<>")
+		assert.True(t, strings.HasSuffix(cid, "@example.com"))
+		assert.Equal(t, uses, strings.Count(html, `"cid:`+cid+`"`))
+	}
+
+	// The plain text is unaffected
+	text, err := h.GeneratePlainText(email)
+	assert.NoError(t, err)
+	assert.Equal(t, text, strings.ReplaceAll(parts[0].content, "\r\n", "\n"))
+}
+
+func TestNewMessage(t *testing.T) {
+	built, err := new(Hermes).BuildMessage(Envelope{
+		From: "Hermes <no-reply@example.com>",
+		To:   []string{"jon@example.com"},
+	}, Email{Body: Body{Name: "Jon Snow"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	m, err := NewMessage(built.From(), built.Recipients(), built.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, built, m)
+
+	_, err = NewMessage("", []string{"jon@example.com"}, built.Bytes())
+	assert.ErrorIs(t, err, ErrEmptySender)
+	_, err = NewMessage("no-reply@example.com", nil, built.Bytes())
+	assert.ErrorIs(t, err, ErrNoRecipients)
+	_, err = NewMessage("no-reply@example.com", []string{"jon@example.com"}, []byte("not a message"))
+	assert.Error(t, err)
+}
+
+func TestBuildMessage_ImageBlocks(t *testing.T) {
+	h := Hermes{
+		Product: Product{Name: "Hermes", Logo: "logo.png"},
+		Images:  ImageMap{"logo.png": []byte("logo"), "banner.png": []byte("old banner")},
+	}
+	email := Email{Body: Body{Blocks: Blocks{
+		ImageBlock{Src: "banner.png", Alt: "Banner", Data: []byte("\x89PNG\r\n\x1a\nbanner")},
+		ImageBlock{Src: "https://example.com/remote.png", Alt: "Remote"},
+	}}}
+
+	m, err := h.BuildMessage(Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}}, email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, parts := readMessage(t, m.Bytes())
+	if !assert.Len(t, parts, 4) {
+		return
+	}
+	assert.Contains(t, parts[1].content, "https://example.com/remote.png")
+	assert.Equal(t, "logo", parts[2].content)
+	bannerPart := parts[3]
+	assert.Equal(t, "\x89PNG\r\n\x1a\nbanner", bannerPart.content, "The data of the block should win over Hermes.Images")
+	assert.Equal(t, "image/png", bannerPart.header.Get("Content-Type"))
+	assert.Contains(t, parts[1].content, `"cid:`+strings.Trim(bannerPart.header.Get("Content-Id"), "<>")+`"`)
+}
+
+func TestImageMap(t *testing.T) {
+	images := ImageMap{"logo.png": []byte("logo")}
+	data, err := fs.ReadFile(images, "logo.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "logo", string(data))
+	f, err := images.Open("logo.png")
+	if assert.NoError(t, err) {
+		info, err := f.Stat()
+		assert.NoError(t, err)
+		assert.Equal(t, "logo.png", info.Name())
+		assert.Equal(t, int64(4), info.Size())
+		assert.NoError(t, f.Close())
+	}
+
+	_, err = images.Open("missing.png")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = images.ReadFile("../logo.png")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+func TestBuildMessage_Attachments(t *testing.T) {
+	h := Hermes{
+		Product: Product{Name: "Hermes", Logo: "logo.png"},
+		Images:  ImageMap{"logo.png": []byte("logo")},
+	}
+	email := Email{
+		Body: Body{Name: "Jon Snow", IntrosUnsafe: []template.HTML{`<img src="cid:chart">`}},
+		Attachments: []Attachment{
+			{Name: "invoice.pdf", Data: []byte("%PDF-1.4 invoice")},
+			{Name: "report", Reader: strings.NewReader("a,b\n1,2\n"), ContentType: "text/csv"},
+			{Name: "chart.png", Data: []byte("chart"), Disposition: DispositionInline, ContentID: "chart"},
+		},
+	}
+
+	m, err := h.BuildMessage(Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}}, email)
+	if !assert.NoError(t, err) {
+		return
+	}
+	header, parts := readMessage(t, m.Bytes())
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	// text, html, logo, chart (related), then invoice and report (mixed)
+	if !assert.Len(t, parts, 6) {
+		return
+	}
+	assert.Equal(t, "image/png", parts[2].header.Get("Content-Type"))
+	assert.Equal(t, "chart", parts[3].content)
+	assert.Equal(t, "<chart>", parts[3].header.Get("Content-Id"))
+	assert.Equal(t, "inline; filename=chart.png", parts[3].header.Get("Content-Disposition"))
+	assert.Equal(t, "application/pdf", parts[4].header.Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=invoice.pdf", parts[4].header.Get("Content-Disposition"))
+	assert.Equal(t, "%PDF-1.4 invoice", parts[4].content)
+	assert.Equal(t, "text/csv", parts[5].header.Get("Content-Type"))
+	assert.Equal(t, "a,b\n1,2\n", parts[5].content)
+
+	_, err = h.BuildMessage(Envelope{From: "no-reply@example.com", To: []string{"jon@example.com"}}, Email{
+		Attachments: []Attachment{{Data: []byte("data")}},
+	})
+	assert.ErrorIs(t, err, ErrUnnamedAttachment)
+}
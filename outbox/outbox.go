@@ -0,0 +1,482 @@
+// Package outbox spools messages to disk and delivers them in the background,
+// retrying temporary failures with an exponential backoff.
+//
+// The spool directory holds a queue directory with the messages waiting for
+// delivery, and a dead directory with the messages that failed for good, or
+// with their recipients refused for good when the others were not. Each
+// message is stored as an .eml file along with a .json file describing its
+// delivery. A spool directory is meant to be used by a single process.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/go-hermes/hermes/v2/transport"
+)
+
+var (
+	// ErrEmptyDirectory is returned when creating an outbox without spool directory
+	ErrEmptyDirectory = errors.New("outbox directory is empty")
+	// ErrNilSender is returned when creating an outbox without sender
+	ErrNilSender = errors.New("outbox sender is nil")
+	// ErrRunning is returned when running an outbox that is already running
+	ErrRunning = errors.New("outbox is already running")
+)
+
+// errCorrupted is returned when loading a queued message whose description cannot be decoded
+var errCorrupted = errors.New("corrupted spooled message")
+
+const (
+	queueDir = "queue"
+	deadDir  = "dead"
+)
+
+// Config is the configuration of an Outbox
+type Config struct {
+	Dir          string           // Spool directory, created if needed
+	Sender       transport.Sender // Sender delivering the messages
+	Workers      int              // Number of messages sent concurrently (default to 4)
+	MinBackoff   time.Duration    // Delay before the first retry, doubled after each attempt (default to 1 minute)
+	MaxBackoff   time.Duration    // Maximum delay between two attempts, at least MinBackoff (default to 1 hour)
+	MaxAttempts  int              // Attempts after which a message is a dead letter (default to 10)
+	PollInterval time.Duration    // Interval at which deferred messages are checked (default to 1 second)
+	// OnEvent is called, possibly concurrently, when the state of a message changes
+	OnEvent func(Event)
+}
+
+// EventType is the kind of an Event
+type EventType string
+
+const (
+	// EventQueued is emitted when a message is spooled
+	EventQueued EventType = "queued"
+	// EventSent is emitted when a message is delivered and removed from the spool
+	EventSent EventType = "sent"
+	// EventDeferred is emitted when sending a message failed temporarily and will be retried
+	EventDeferred EventType = "deferred"
+	// EventFailed is emitted when a message is moved to the dead letters, after a
+	// permanent failure or too many attempts. When only some recipients are
+	// refused for good, they are dead letters on their own, under a new ID.
+	EventFailed EventType = "failed"
+)
+
+// Event tells about the delivery of a spooled message
+type Event struct {
+	Type        EventType
+	ID          string    // Identifier of the message in the spool
+	MessageID   string    // Message-ID header of the message
+	Recipients  []string  // Recipients the message is sent to
+	Attempts    int       // Number of delivery attempts so far
+	NextAttempt time.Time // Time of the next attempt of deferred messages
+	Err         error     // Error of the last attempt of deferred and failed messages
+}
+
+// entry describes the delivery of a spooled message
+type entry struct {
+	ID          string    `json:"-"`
+	MessageID   string    `json:"message_id"`
+	From        string    `json:"from"`
+	Recipients  []string  `json:"recipients"`
+	QueuedAt    time.Time `json:"queued_at"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Outbox is a durable queue of messages. Messages are spooled by Enqueue and
+// delivered while Run is running, including those spooled by a previous run.
+type Outbox struct {
+	cfg  Config
+	wake chan struct{}
+
+	mu       sync.Mutex
+	running  bool
+	inFlight map[string]bool
+}
+
+// New returns an outbox spooling messages in cfg.Dir
+func New(cfg Config) (*Outbox, error) {
+	if cfg.Dir == "" {
+		return nil, ErrEmptyDirectory
+	}
+	if cfg.Sender == nil {
+		return nil, ErrNilSender
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Minute
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	cfg.MaxBackoff = max(cfg.MaxBackoff, cfg.MinBackoff)
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	for _, dir := range []string{queueDir, deadDir} {
+		if err := os.MkdirAll(filepath.Join(cfg.Dir, dir), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &Outbox{
+		cfg:      cfg,
+		wake:     make(chan struct{}, 1),
+		inFlight: map[string]bool{},
+	}, nil
+}
+
+// Enqueue spools the message for delivery and returns its identifier in the spool
+func (o *Outbox) Enqueue(msg *hermes.Message) (string, error) {
+	if msg == nil {
+		return "", transport.ErrNilMessage
+	}
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	e := &entry{
+		ID:         id,
+		MessageID:  msg.MessageID(),
+		From:       msg.From(),
+		Recipients: msg.Recipients(),
+		QueuedAt:   time.Now().UTC(),
+	}
+	e.NextAttempt = e.QueuedAt
+
+	// The message is written before its description, which marks it as queued
+	if err = writeFile(o.path(queueDir, id, ".eml"), msg.Bytes()); err != nil {
+		return "", fmt.Errorf("spooling message: %w", err)
+	}
+	if err = o.save(queueDir, e); err != nil {
+		_ = os.Remove(o.path(queueDir, id, ".eml"))
+		return "", fmt.Errorf("spooling message: %w", err)
+	}
+	o.emit(Event{Type: EventQueued, ID: id, MessageID: e.MessageID, Recipients: e.Recipients})
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Run delivers the spooled messages until ctx is canceled, then waits for
+// the messages being sent. Messages interrupted by the cancellation are
+// attempted again by the next run.
+func (o *Outbox) Run(ctx context.Context) error {
+	o.mu.Lock()
+	if o.running {
+		o.mu.Unlock()
+		return ErrRunning
+	}
+	o.running = true
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		o.running = false
+		clear(o.inFlight) // including the messages due but not handed to a worker
+		o.mu.Unlock()
+	}()
+
+	jobs := make(chan *entry)
+	var wg sync.WaitGroup
+	for range o.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				o.deliver(ctx, e)
+				o.mu.Lock()
+				delete(o.inFlight, e.ID)
+				o.mu.Unlock()
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	ticker := time.NewTicker(o.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		due, err := o.due(time.Now())
+		if err != nil {
+			return err
+		}
+		for _, e := range due {
+			select {
+			case jobs <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-o.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// due returns the queued messages to attempt now, marking them in flight.
+// The messages whose description cannot be decoded are moved to the dead
+// letters.
+func (o *Outbox) due(now time.Time) ([]*entry, error) {
+	names, err := filepath.Glob(filepath.Join(o.cfg.Dir, queueDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names) // identifiers start with the time they were queued at
+	var due []*entry
+	corrupted := map[string]error{}
+	o.mu.Lock()
+	for _, name := range names {
+		id := strings.TrimSuffix(filepath.Base(name), ".json")
+		if o.inFlight[id] {
+			continue
+		}
+		e, err := o.load(id)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if errors.Is(err, errCorrupted) {
+			corrupted[id] = err
+			continue
+		}
+		if err != nil {
+			o.mu.Unlock()
+			return nil, err
+		}
+		if e.NextAttempt.After(now) {
+			continue
+		}
+		o.inFlight[id] = true
+		due = append(due, e)
+	}
+	o.mu.Unlock()
+
+	for _, id := range slices.Sorted(maps.Keys(corrupted)) {
+		err := corrupted[id]
+		if moveErr := o.buryCorrupted(id); moveErr != nil {
+			err = errors.Join(err, moveErr)
+		}
+		o.emit(Event{Type: EventFailed, ID: id, Err: err})
+	}
+	return due, nil
+}
+
+// deliver attempts to send the message of e, then removes it from the queue
+// when it was sent, reschedules it or moves it to the dead letters
+func (o *Outbox) deliver(ctx context.Context, e *entry) {
+	raw, err := os.ReadFile(o.path(queueDir, e.ID, ".eml"))
+	lost := errors.Is(err, os.ErrNotExist) // retrying would not bring it back
+	if err == nil {
+		err = o.send(ctx, e, raw)
+	}
+	if ctx.Err() != nil {
+		return // not an attempt, the message is sent again by the next run
+	}
+
+	e.Attempts++
+	if err == nil {
+		_ = os.Remove(o.path(queueDir, e.ID, ".json"))
+		_ = os.Remove(o.path(queueDir, e.ID, ".eml"))
+		o.emit(Event{Type: EventSent, ID: e.ID, MessageID: e.MessageID, Recipients: e.Recipients, Attempts: e.Attempts})
+		return
+	}
+
+	e.LastError = err.Error()
+	if lost || transport.IsPermanent(err) || e.Attempts >= o.cfg.MaxAttempts {
+		if moveErr := o.bury(e); moveErr != nil {
+			err = errors.Join(err, moveErr)
+		}
+		o.emit(Event{Type: EventFailed, ID: e.ID, MessageID: e.MessageID, Recipients: e.Recipients, Attempts: e.Attempts, Err: err})
+		return
+	}
+
+	e.NextAttempt = time.Now().UTC().Add(o.backoff(e.Attempts))
+	if saveErr := o.save(queueDir, e); saveErr != nil {
+		err = errors.Join(err, saveErr)
+	}
+	o.emit(Event{Type: EventDeferred, ID: e.ID, MessageID: e.MessageID, Recipients: e.Recipients, Attempts: e.Attempts, NextAttempt: e.NextAttempt, Err: err})
+}
+
+// send sends the message of e to its recipients. When some of them are
+// refused for good, but not all, they are moved to the dead letters on their
+// own, and the message is sent again to the others right away.
+func (o *Outbox) send(ctx context.Context, e *entry, raw []byte) error {
+	for {
+		msg, err := hermes.NewMessage(e.From, e.Recipients, raw)
+		if err != nil {
+			return err
+		}
+		err = o.cfg.Sender.Send(ctx, msg)
+		refused := refusedRecipients(err)
+		rest := slices.DeleteFunc(slices.Clone(e.Recipients), func(rcpt string) bool {
+			_, ok := refused[rcpt]
+			return ok
+		})
+		if len(rest) == 0 || len(rest) == len(e.Recipients) || ctx.Err() != nil {
+			return err
+		}
+
+		dead := &entry{
+			MessageID: e.MessageID,
+			From:      e.From,
+			QueuedAt:  e.QueuedAt,
+			Attempts:  e.Attempts + 1,
+		}
+		var errs []error
+		for _, rcpt := range e.Recipients {
+			if rcptErr, ok := refused[rcpt]; ok {
+				dead.Recipients = append(dead.Recipients, rcpt)
+				errs = append(errs, rcptErr)
+			}
+		}
+		err = errors.Join(errs...)
+		dead.LastError = err.Error()
+		if dead.ID, err = newID(); err != nil {
+			return err
+		}
+		if err = writeFile(o.path(deadDir, dead.ID, ".eml"), raw); err == nil {
+			err = o.save(deadDir, dead)
+		}
+		if err != nil {
+			return err
+		}
+		o.emit(Event{Type: EventFailed, ID: dead.ID, MessageID: dead.MessageID, Recipients: dead.Recipients, Attempts: dead.Attempts, Err: errors.Join(errs...)})
+
+		e.Recipients = rest
+		if err = o.save(queueDir, e); err != nil {
+			return err
+		}
+	}
+}
+
+// refusedRecipients returns the errors of the recipients refused for good,
+// by recipient, among the errors joined in err
+func refusedRecipients(err error) map[string]error {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	refused := map[string]error{}
+	for _, err := range errs {
+		var rcptErr *transport.RecipientError
+		if errors.As(err, &rcptErr) && transport.IsPermanent(err) {
+			refused[rcptErr.Recipient] = err
+		}
+	}
+	return refused
+}
+
+// backoff returns the delay before the attempt following the given number of attempts
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.cfg.MinBackoff
+	for i := 1; i < attempts && d < o.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, o.cfg.MaxBackoff)
+}
+
+// bury moves the message of e to the dead letters. Its description is
+// removed from the queue even when its message file is missing.
+func (o *Outbox) bury(e *entry) error {
+	if err := o.save(deadDir, e); err != nil {
+		return err
+	}
+	if err := os.Rename(o.path(queueDir, e.ID, ".eml"), o.path(deadDir, e.ID, ".eml")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Remove(o.path(queueDir, e.ID, ".json"))
+}
+
+// buryCorrupted moves a message whose description cannot be decoded to the
+// dead letters, as it is
+func (o *Outbox) buryCorrupted(id string) error {
+	if err := os.Rename(o.path(queueDir, id, ".eml"), o.path(deadDir, id, ".eml")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Rename(o.path(queueDir, id, ".json"), o.path(deadDir, id, ".json"))
+}
+
+// load reads the description of a queued message
+func (o *Outbox) load(id string) (*entry, error) {
+	data, err := os.ReadFile(o.path(queueDir, id, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{ID: id}
+	if err = json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errCorrupted, id, err)
+	}
+	return e, nil
+}
+
+// save writes the description of a message in dir
+func (o *Outbox) save(dir string, e *entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(o.path(dir, e.ID, ".json"), data)
+}
+
+func (o *Outbox) path(dir, id, ext string) string {
+	return filepath.Join(o.cfg.Dir, dir, id+ext)
+}
+
+func (o *Outbox) emit(ev Event) {
+	if o.cfg.OnEvent != nil {
+		o.cfg.OnEvent(ev)
+	}
+}
+
+// writeFile atomically replaces the content of the file at name
+func writeFile(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// newID returns a unique identifier, sorted by creation time
+func newID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,328 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/go-hermes/hermes/v2/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMessage(t *testing.T) *hermes.Message {
+	t.Helper()
+	msg, err := new(hermes.Hermes).BuildMessage(hermes.Envelope{
+		From: "Hermes <hermes@example.com>",
+		To:   []string{"jon@example.com"},
+	}, hermes.Email{Body: hermes.Body{Name: "Jon Snow"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// events records the events of an outbox
+type events struct {
+	mu     sync.Mutex
+	events []Event
+	ch     chan Event
+}
+
+func newEvents() *events {
+	return &events{ch: make(chan Event, 100)}
+}
+
+func (e *events) record(ev Event) {
+	e.mu.Lock()
+	e.events = append(e.events, ev)
+	e.mu.Unlock()
+	e.ch <- ev
+}
+
+// wait waits for an event of the given type
+func (e *events) wait(t *testing.T, typ EventType) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-e.ch:
+			if ev.Type == typ {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("No %s event", typ)
+		}
+	}
+}
+
+func (e *events) types() []EventType {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var types []EventType
+	for _, ev := range e.events {
+		types = append(types, ev.Type)
+	}
+	return types
+}
+
+// run runs the outbox until the end of the test
+func run(t *testing.T, o *Outbox) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- o.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func queued(t *testing.T, dir, sub string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, sub, "*"))
+	assert.NoError(t, err)
+	return names
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{Sender: new(transport.Recorder)})
+	assert.ErrorIs(t, err, ErrEmptyDirectory)
+	_, err = New(Config{Dir: t.TempDir()})
+	assert.ErrorIs(t, err, ErrNilSender)
+
+	dir := t.TempDir()
+	o, err := New(Config{Dir: dir, Sender: new(transport.Recorder)})
+	assert.NoError(t, err)
+	assert.DirExists(t, filepath.Join(dir, "queue"))
+	assert.DirExists(t, filepath.Join(dir, "dead"))
+	assert.Equal(t, time.Minute, o.backoff(1))
+	assert.Equal(t, 4*time.Minute, o.backoff(3))
+	assert.Equal(t, time.Hour, o.backoff(10))
+
+	// A maximum below the minimum backoff is raised to it, not to the default
+	o, err = New(Config{Dir: dir, Sender: new(transport.Recorder), MinBackoff: 10 * time.Minute, MaxBackoff: 5 * time.Minute})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, o.backoff(1))
+	assert.Equal(t, 10*time.Minute, o.backoff(10))
+	o, err = New(Config{Dir: dir, Sender: new(transport.Recorder), MinBackoff: 2 * time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, o.backoff(10))
+}
+
+func TestOutbox_Send(t *testing.T) {
+	dir := t.TempDir()
+	sender := new(transport.Recorder)
+	ev := newEvents()
+	o, err := New(Config{Dir: dir, Sender: sender, OnEvent: ev.record})
+	assert.NoError(t, err)
+	run(t, o)
+
+	msg := testMessage(t)
+	id, err := o.Enqueue(msg)
+	assert.NoError(t, err)
+	sent := ev.wait(t, EventSent)
+	assert.Equal(t, id, sent.ID)
+	assert.Equal(t, msg.MessageID(), sent.MessageID)
+	assert.Equal(t, 1, sent.Attempts)
+
+	if messages := sender.Messages(); assert.Len(t, messages, 1) {
+		assert.Equal(t, msg, messages[0])
+	}
+	assert.Equal(t, []EventType{EventQueued, EventSent}, ev.types())
+	assert.Empty(t, queued(t, dir, "queue"), "Sent messages should be removed from the spool")
+}
+
+func TestOutbox_Retry(t *testing.T) {
+	dir := t.TempDir()
+	failures := 2
+	sender := &transport.Recorder{Fail: func(*hermes.Message) error {
+		if failures > 0 {
+			failures--
+			return &textproto.Error{Code: 451, Msg: "try again later"}
+		}
+		return nil
+	}}
+	ev := newEvents()
+	o, err := New(Config{
+		Dir:          dir,
+		Sender:       sender,
+		Workers:      1,
+		MinBackoff:   10 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+		OnEvent:      ev.record,
+	})
+	assert.NoError(t, err)
+	run(t, o)
+
+	_, err = o.Enqueue(testMessage(t))
+	assert.NoError(t, err)
+	first := ev.wait(t, EventDeferred)
+	assert.Equal(t, 1, first.Attempts)
+	assert.ErrorContains(t, first.Err, "try again later")
+	second := ev.wait(t, EventDeferred)
+	assert.Equal(t, 2, second.Attempts)
+	assert.GreaterOrEqual(t, second.NextAttempt.Sub(first.NextAttempt), 10*time.Millisecond, "Backoff should grow")
+	assert.Equal(t, 3, ev.wait(t, EventSent).Attempts)
+	assert.Len(t, sender.Messages(), 1)
+}
+
+func TestOutbox_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"permanent failure", &textproto.Error{Code: 550, Msg: "no such user"}},
+		{"too many attempts", errors.New("connection reset")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sender := &transport.Recorder{Fail: func(*hermes.Message) error { return test.err }}
+			ev := newEvents()
+			o, err := New(Config{
+				Dir:          dir,
+				Sender:       sender,
+				MinBackoff:   time.Millisecond,
+				MaxAttempts:  3,
+				PollInterval: time.Millisecond,
+				OnEvent:      ev.record,
+			})
+			assert.NoError(t, err)
+			run(t, o)
+
+			id, err := o.Enqueue(testMessage(t))
+			assert.NoError(t, err)
+			failed := ev.wait(t, EventFailed)
+			assert.Equal(t, id, failed.ID)
+			assert.ErrorIs(t, failed.Err, test.err)
+
+			assert.Empty(t, queued(t, dir, "queue"))
+			assert.FileExists(t, filepath.Join(dir, "dead", id+".eml"))
+			data, err := os.ReadFile(filepath.Join(dir, "dead", id+".json"))
+			assert.NoError(t, err)
+			var dead entry
+			assert.NoError(t, json.Unmarshal(data, &dead))
+			assert.Equal(t, test.err.Error(), dead.LastError)
+			assert.Equal(t, failed.Attempts, dead.Attempts)
+		})
+	}
+}
+
+func TestOutbox_RefusedRecipients(t *testing.T) {
+	dir := t.TempDir()
+	refused := &transport.RecipientError{Recipient: "unknown@example.com", Err: &textproto.Error{Code: 550, Msg: "no such user"}}
+	sender := &transport.Recorder{Fail: func(msg *hermes.Message) error {
+		if slices.Contains(msg.Recipients(), refused.Recipient) {
+			return errors.Join(refused)
+		}
+		return nil
+	}}
+	ev := newEvents()
+	o, err := New(Config{Dir: dir, Sender: sender, OnEvent: ev.record})
+	assert.NoError(t, err)
+	run(t, o)
+
+	msg, err := new(hermes.Hermes).BuildMessage(hermes.Envelope{
+		From: "hermes@example.com",
+		To:   []string{"jon@example.com", "unknown@example.com", "arya@example.com"},
+	}, hermes.Email{})
+	assert.NoError(t, err)
+	id, err := o.Enqueue(msg)
+	assert.NoError(t, err)
+
+	// The refused recipient is a dead letter on its own
+	failed := ev.wait(t, EventFailed)
+	assert.NotEqual(t, id, failed.ID)
+	assert.Equal(t, []string{"unknown@example.com"}, failed.Recipients)
+	assert.ErrorIs(t, failed.Err, refused)
+	data, err := os.ReadFile(filepath.Join(dir, "dead", failed.ID+".json"))
+	assert.NoError(t, err)
+	var dead entry
+	assert.NoError(t, json.Unmarshal(data, &dead))
+	assert.Equal(t, []string{"unknown@example.com"}, dead.Recipients)
+	assert.Equal(t, refused.Error(), dead.LastError)
+	assert.FileExists(t, filepath.Join(dir, "dead", failed.ID+".eml"))
+
+	// The message is delivered to the other recipients
+	sent := ev.wait(t, EventSent)
+	assert.Equal(t, id, sent.ID)
+	assert.Equal(t, 1, sent.Attempts)
+	assert.Equal(t, []string{"jon@example.com", "arya@example.com"}, sent.Recipients)
+	if messages := sender.Messages(); assert.Len(t, messages, 1) {
+		assert.Equal(t, []string{"jon@example.com", "arya@example.com"}, messages[0].Recipients())
+	}
+	assert.Empty(t, queued(t, dir, "queue"))
+}
+
+func TestOutbox_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	o, err := New(Config{Dir: dir, Sender: new(transport.Recorder)})
+	assert.NoError(t, err)
+	corrupted, err := o.Enqueue(testMessage(t))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "queue", corrupted+".json"), []byte("{"), 0600))
+	lost, err := o.Enqueue(testMessage(t))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(filepath.Join(dir, "queue", lost+".eml")))
+	sent, err := o.Enqueue(testMessage(t))
+	assert.NoError(t, err)
+
+	ev := newEvents()
+	o, err = New(Config{Dir: dir, Sender: new(transport.Recorder), Workers: 1, OnEvent: ev.record})
+	assert.NoError(t, err)
+	run(t, o)
+
+	// Entries that cannot be decoded are dead letters, as they are
+	failed := ev.wait(t, EventFailed)
+	assert.Equal(t, corrupted, failed.ID)
+	assert.ErrorIs(t, failed.Err, errCorrupted)
+	assert.FileExists(t, filepath.Join(dir, "dead", corrupted+".json"))
+	assert.FileExists(t, filepath.Join(dir, "dead", corrupted+".eml"))
+
+	// Messages whose file is missing fail for good
+	failed = ev.wait(t, EventFailed)
+	assert.Equal(t, lost, failed.ID)
+	assert.ErrorIs(t, failed.Err, os.ErrNotExist)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.FileExists(t, filepath.Join(dir, "dead", lost+".json"))
+
+	// The others are still delivered
+	assert.Equal(t, sent, ev.wait(t, EventSent).ID)
+	assert.Empty(t, queued(t, dir, "queue"))
+}
+
+func TestOutbox_Durable(t *testing.T) {
+	dir := t.TempDir()
+	o, err := New(Config{Dir: dir, Sender: new(transport.Recorder)})
+	assert.NoError(t, err)
+	msg := testMessage(t)
+	_, err = o.Enqueue(msg)
+	assert.NoError(t, err)
+	assert.Len(t, queued(t, dir, "queue"), 2, "Message should be spooled with its description")
+
+	// Messages spooled by a previous process are sent
+	sender := new(transport.Recorder)
+	ev := newEvents()
+	o, err = New(Config{Dir: dir, Sender: sender, OnEvent: ev.record})
+	assert.NoError(t, err)
+	run(t, o)
+	ev.wait(t, EventSent)
+	assert.Equal(t, []*hermes.Message{msg}, sender.Messages())
+}
+
+func TestOutbox_Run(t *testing.T) {
+	o, err := New(Config{Dir: t.TempDir(), Sender: new(transport.Recorder)})
+	assert.NoError(t, err)
+	run(t, o)
+	time.Sleep(10 * time.Millisecond)
+	assert.ErrorIs(t, o.Run(context.Background()), ErrRunning)
+	_, err = o.Enqueue(nil)
+	assert.ErrorIs(t, err, transport.ErrNilMessage)
+}
@@ -0,0 +1,263 @@
+// Package preview serves a gallery of emails rendered with several themes,
+// reloading the open pages when the files they are made of change on disk.
+package preview
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+var (
+	//go:embed templates
+	templatesFS embed.FS
+
+	pages = template.Must(template.ParseFS(templatesFS, "templates/*.html"))
+)
+
+// Email is an email of the gallery
+type Email struct {
+	Name   string
+	Hermes hermes.Hermes // Configuration of the email, its theme is replaced by the themes of the gallery
+	Email  hermes.Email
+}
+
+// Gallery is the set of emails shown by the preview, each one rendered with all the themes
+type Gallery struct {
+	Themes []hermes.Theme // Themes of the gallery (default to the registered themes)
+	Emails []Email
+}
+
+// Config is the configuration of a preview handler
+type Config struct {
+	Gallery Gallery // Emails shown when Load is nil
+	// Load, when set, is called for each page to get the gallery, e.g. to read
+	// again the files describing the emails
+	Load func() (Gallery, error)
+	// Watch lists files and directories, like theme templates and stylesheets,
+	// whose changes reload the open pages
+	Watch        []string
+	PollInterval time.Duration // Interval at which watched files are checked (default to 500ms)
+}
+
+// Handler serves the gallery:
+//
+//	/         lists the emails and themes
+//	/email    shows an email (name and theme query parameters), with HTML and plain text tabs
+//	/render   returns an email rendered in HTML or plain text (format query parameter)
+//	/events   streams reload events to the open pages (server-sent events)
+type Handler struct {
+	cfg Config
+	mux *http.ServeMux
+}
+
+// NewHandler returns a handler serving the gallery of cfg. It can be mounted
+// under a prefix with http.StripPrefix.
+func NewHandler(cfg Config) *Handler {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 500 * time.Millisecond
+	}
+	h := &Handler{cfg: cfg, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /{$}", h.serveIndex)
+	h.mux.HandleFunc("GET /email", h.serveEmail)
+	h.mux.HandleFunc("GET /render", h.serveRender)
+	h.mux.HandleFunc("GET /events", h.serveEvents)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// gallery returns the current gallery
+func (h *Handler) gallery() (Gallery, error) {
+	g := h.cfg.Gallery
+	if h.cfg.Load != nil {
+		var err error
+		if g, err = h.cfg.Load(); err != nil {
+			return Gallery{}, err
+		}
+	}
+	if len(g.Themes) == 0 {
+		for _, info := range hermes.Themes() {
+			if theme, err := hermes.LookupTheme(info.Name); err == nil {
+				g.Themes = append(g.Themes, theme)
+			}
+		}
+	}
+	return g, nil
+}
+
+// lookup returns the email and theme of g named by the query of r
+func lookup(g Gallery, r *http.Request) (*Email, hermes.Theme, error) {
+	name, themeName := r.URL.Query().Get("name"), r.URL.Query().Get("theme")
+	var email *Email
+	for i := range g.Emails {
+		if g.Emails[i].Name == name {
+			email = &g.Emails[i]
+			break
+		}
+	}
+	if email == nil {
+		return nil, nil, fmt.Errorf("%w: email %q", fs.ErrNotExist, name)
+	}
+	for _, t := range g.Themes {
+		if t.Name() == themeName {
+			return email, t, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: theme %q", fs.ErrNotExist, themeName)
+}
+
+// render renders the email with the theme
+func render(ctx context.Context, email *Email, theme hermes.Theme) (*hermes.Rendered, error) {
+	config := email.Hermes
+	config.Theme = theme
+	r, err := hermes.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return r.Render(ctx, email.Email)
+}
+
+func (h *Handler) serveIndex(w http.ResponseWriter, _ *http.Request) {
+	g, err := h.gallery()
+	h.execute(w, "index.html", struct {
+		Gallery Gallery
+		Err     error
+	}{g, err})
+}
+
+func (h *Handler) serveEmail(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Name, Theme string
+		Themes      []hermes.Theme
+		Rendered    *hermes.Rendered
+		Err         error
+	}{Name: r.URL.Query().Get("name"), Theme: r.URL.Query().Get("theme")}
+
+	g, err := h.gallery()
+	if err == nil {
+		data.Themes = g.Themes
+		var email *Email
+		var theme hermes.Theme
+		if email, theme, err = lookup(g, r); err == nil {
+			data.Rendered, err = render(r.Context(), email, theme)
+		}
+	}
+	data.Err = err
+	h.execute(w, "email.html", data)
+}
+
+func (h *Handler) serveRender(w http.ResponseWriter, r *http.Request) {
+	g, err := h.gallery()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	email, theme, err := lookup(g, r)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var res *hermes.Rendered
+	if err == nil {
+		res, err = render(r.Context(), email, theme)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(res.Text))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(res.HTML))
+}
+
+// serveEvents sends a reload event each time a watched file changes, until
+// the page is closed
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = fmt.Fprint(w, ": watching\n\n")
+	flusher.Flush()
+
+	last := fingerprint(h.cfg.Watch)
+	ticker := time.NewTicker(h.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			current := fingerprint(h.cfg.Watch)
+			if current == last {
+				continue
+			}
+			last = current
+			if _, err := fmt.Fprint(w, "event: reload\ndata: {}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handler) execute(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := pages.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// watched files, and of the files of the watched directories
+func fingerprint(paths []string) string {
+	var sum uint64
+	var count int
+	var latest time.Time
+	add := func(path string, info fs.FileInfo) {
+		count++
+		sum += uint64(info.Size())
+		for _, c := range path {
+			sum = sum*31 + uint64(c)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	for _, p := range paths {
+		_ = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // missing files are part of the fingerprint by their absence
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				add(path, info)
+			}
+			return nil
+		})
+	}
+	return fmt.Sprintf("%d:%d:%d", count, sum, latest.UnixNano())
+}
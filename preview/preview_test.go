@@ -0,0 +1,154 @@
+package preview
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+var testGallery = Gallery{
+	Emails: []Email{
+		{
+			Name:   "welcome",
+			Hermes: hermes.Hermes{Product: hermes.Product{Name: "Hermes", Link: "https://example-hermes.com/"}},
+			Email: hermes.Email{
+				Subject: "Welcome to Hermes",
+				Body:    hermes.Body{Name: "Jon Snow", Intros: []string{"We're very excited to have you on board."}},
+			},
+		},
+		{
+			Name:  "reset",
+			Email: hermes.Email{Body: hermes.Body{Name: "Arya Stark", Intros: []string{"You have requested a password reset."}}},
+		},
+	},
+}
+
+func get(t *testing.T, h http.Handler, target string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestHandler_Index(t *testing.T) {
+	h := NewHandler(Config{Gallery: testGallery})
+	code, body := get(t, h, "/")
+	assert.Equal(t, http.StatusOK, code)
+	for _, email := range []string{"welcome", "reset"} {
+		for _, theme := range []string{"default", "flat"} {
+			assert.Contains(t, body, `href="email?name=`+email+`&amp;theme=`+theme+`"`)
+		}
+	}
+	assert.Contains(t, body, `new EventSource("events")`)
+
+	h = NewHandler(Config{Load: func() (Gallery, error) { return Gallery{}, errors.New("invalid spec") }})
+	_, body = get(t, h, "/")
+	assert.Contains(t, body, "invalid spec")
+}
+
+func TestHandler_Email(t *testing.T) {
+	h := NewHandler(Config{Gallery: testGallery})
+	code, body := get(t, h, "/email?name=welcome&theme=flat")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Welcome to Hermes")
+	assert.Contains(t, body, `src="render?name=welcome&amp;theme=flat&amp;format=html"`)
+	assert.Contains(t, body, `data-format="text"`)
+	assert.Contains(t, body, `data-width="375px"`)
+	assert.Contains(t, body, `data-dark`)
+
+	_, body = get(t, h, "/email?name=unknown&theme=flat")
+	assert.Contains(t, body, `email &#34;unknown&#34;`)
+}
+
+func TestHandler_Render(t *testing.T) {
+	h := NewHandler(Config{Gallery: testGallery})
+	r, err := hermes.New(hermes.Hermes{
+		Theme:   new(hermes.Flat),
+		Product: hermes.Product{Name: "Hermes", Link: "https://example-hermes.com/"},
+	})
+	assert.NoError(t, err)
+	want, err := r.Render(context.Background(), testGallery.Emails[0].Email)
+	assert.NoError(t, err)
+
+	code, body := get(t, h, "/render?name=welcome&theme=flat&format=html")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, want.HTML, body)
+	code, body = get(t, h, "/render?name=welcome&theme=flat&format=text")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, want.Text, body)
+
+	code, _ = get(t, h, "/render?name=welcome&theme=unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestHandler_Load(t *testing.T) {
+	intro := "First version"
+	loads := 0
+	h := NewHandler(Config{Load: func() (Gallery, error) {
+		loads++
+		return Gallery{Emails: []Email{{Name: "welcome", Email: hermes.Email{Body: hermes.Body{Intros: []string{intro}}}}}}, nil
+	}})
+	_, body := get(t, h, "/render?name=welcome&theme=default&format=text")
+	assert.Contains(t, body, "First version")
+
+	intro = "Second version"
+	_, body = get(t, h, "/render?name=welcome&theme=default&format=text")
+	assert.Contains(t, body, "Second version", "Emails should be loaded again for each page")
+
+	loads = 0
+	_, body = get(t, h, "/email?name=welcome&theme=default")
+	assert.Contains(t, body, "Second version")
+	assert.Equal(t, 1, loads, "Emails should be loaded once per page")
+}
+
+func TestHandler_Events(t *testing.T) {
+	dir := t.TempDir()
+	css := filepath.Join(dir, "theme.css")
+	assert.NoError(t, os.WriteFile(css, []byte("body { color: #000; }"), 0644))
+
+	server := httptest.NewServer(NewHandler(Config{
+		Gallery:      testGallery,
+		Watch:        []string{dir},
+		PollInterval: 10 * time.Millisecond,
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := bufio.NewReader(resp.Body)
+	line, err := events.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, ": watching\n", line, "Stream should be open before files change")
+
+	assert.NoError(t, os.WriteFile(css, []byte("body { color: #fff; background: #000; }"), 0644))
+	for {
+		line, err = events.ReadString('\n')
+		if err == io.EOF || !assert.NoError(t, err, "Reload event should be sent") {
+			return
+		}
+		if strings.HasPrefix(line, "event:") {
+			assert.Equal(t, "event: reload\n", line)
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package hermes
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrThemeExists is returned when registering a theme under a name already registered
+	ErrThemeExists = errors.New("theme already registered")
+	// ErrUnknownTheme is returned when looking up a theme that is not registered
+	ErrUnknownTheme = errors.New("unknown theme")
+	// ErrInvalidTheme is returned when registering a nil theme, or a theme without name
+	ErrInvalidTheme = errors.New("invalid theme")
+)
+
+// ThemeDescriber is implemented by themes that describe themselves, for
+// tooling listing the registered themes
+type ThemeDescriber interface {
+	Info() ThemeInfo
+}
+
+// registry holds the registered themes by lower-cased name
+var registry = struct {
+	sync.RWMutex
+	themes map[string]Theme
+}{
+	themes: map[string]Theme{
+		Default{}.Name(): new(Default),
+		Flat{}.Name():    new(Flat),
+	},
+}
+
+// RegisterTheme registers a theme under its name, so that it can be looked
+// up with LookupTheme, e.g. from configuration. Names are case-insensitive.
+// Default and Flat are registered by default.
+func RegisterTheme(theme Theme) error {
+	if theme == nil {
+		return ErrInvalidTheme
+	}
+	if v := reflect.ValueOf(theme); v.Kind() == reflect.Pointer && v.IsNil() {
+		return ErrInvalidTheme
+	}
+	name := theme.Name()
+	if strings.TrimSpace(name) == "" {
+		return ErrInvalidTheme
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.themes[strings.ToLower(name)]; ok {
+		return fmt.Errorf("%w: %q", ErrThemeExists, name)
+	}
+	registry.themes[strings.ToLower(name)] = theme
+	return nil
+}
+
+// LookupTheme returns the registered theme with the given name, whatever its case
+func LookupTheme(name string) (Theme, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	theme, ok := registry.themes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTheme, name)
+	}
+	return theme, nil
+}
+
+// Themes returns the description of the registered themes, sorted by name
+func Themes() []ThemeInfo {
+	registry.RLock()
+	defer registry.RUnlock()
+	infos := make([]ThemeInfo, 0, len(registry.themes))
+	for _, theme := range registry.themes {
+		infos = append(infos, DescribeTheme(theme))
+	}
+	slices.SortFunc(infos, func(a, b ThemeInfo) int { return strings.Compare(a.Name, b.Name) })
+	return infos
+}
+
+// DescribeTheme returns the description of the theme, with only its name
+// when it does not implement ThemeDescriber
+func DescribeTheme(theme Theme) ThemeInfo {
+	var info ThemeInfo
+	if d, ok := theme.(ThemeDescriber); ok {
+		info = d.Info()
+	}
+	info.Name = theme.Name()
+	return info
+}
@@ -0,0 +1,107 @@
+package hermes
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unregisterTheme removes a theme registered by a test
+func unregisterTheme(t *testing.T, name string) {
+	t.Cleanup(func() {
+		registry.Lock()
+		defer registry.Unlock()
+		delete(registry.themes, strings.ToLower(name))
+	})
+}
+
+// namedTheme is the default theme under another name, without description
+type namedTheme struct {
+	Default
+	name string
+}
+
+func (t namedTheme) Name() string { return t.name }
+
+func TestLookupTheme(t *testing.T) {
+	theme, err := LookupTheme("default")
+	assert.NoError(t, err)
+	assert.Equal(t, new(Default), theme)
+	theme, err = LookupTheme("flat")
+	assert.NoError(t, err)
+	assert.Equal(t, new(Flat), theme)
+
+	theme, err = LookupTheme("Flat")
+	assert.NoError(t, err)
+	assert.Equal(t, new(Flat), theme)
+
+	theme, err = LookupTheme("fancy")
+	assert.ErrorIs(t, err, ErrUnknownTheme)
+	assert.ErrorContains(t, err, `"fancy"`)
+	assert.Nil(t, theme)
+}
+
+func TestRegisterTheme(t *testing.T) {
+	unregisterTheme(t, "corporate")
+	corporate := namedTheme{name: "corporate"}
+	assert.NoError(t, RegisterTheme(corporate))
+	theme, err := LookupTheme("corporate")
+	assert.NoError(t, err)
+	assert.Equal(t, corporate, theme)
+
+	err = RegisterTheme(namedTheme{name: "corporate"})
+	assert.ErrorIs(t, err, ErrThemeExists)
+	assert.ErrorIs(t, RegisterTheme(new(Flat)), ErrThemeExists)
+	assert.ErrorIs(t, RegisterTheme(nil), ErrInvalidTheme)
+	assert.ErrorIs(t, RegisterTheme(namedTheme{name: " "}), ErrInvalidTheme)
+	assert.ErrorIs(t, RegisterTheme((*Default)(nil)), ErrInvalidTheme)
+
+	// Names are case-insensitive
+	assert.ErrorIs(t, RegisterTheme(namedTheme{name: "Corporate"}), ErrThemeExists)
+	assert.ErrorIs(t, RegisterTheme(namedTheme{name: "FLAT"}), ErrThemeExists)
+	theme, err = LookupTheme("CORPORATE")
+	assert.NoError(t, err)
+	assert.Equal(t, corporate, theme)
+}
+
+func TestRegisterTheme_Concurrent(t *testing.T) {
+	unregisterTheme(t, "concurrent")
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- RegisterTheme(namedTheme{name: "concurrent"})
+			_, _ = LookupTheme("concurrent")
+			_ = Themes()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	registered := 0
+	for err := range errs {
+		if err == nil {
+			registered++
+		} else {
+			assert.ErrorIs(t, err, ErrThemeExists)
+		}
+	}
+	assert.Equal(t, 1, registered, "Theme should be registered once")
+}
+
+func TestThemes(t *testing.T) {
+	unregisterTheme(t, "basic")
+	assert.NoError(t, RegisterTheme(namedTheme{name: "basic"}))
+
+	infos := Themes()
+	if assert.Len(t, infos, 3) {
+		assert.Equal(t, ThemeInfo{Name: "basic", Description: Default{}.Info().Description, Features: []string{"responsive", "rtl"}}, infos[0])
+		assert.Equal(t, "default", infos[1].Name)
+		assert.NotEmpty(t, infos[1].Description)
+		assert.Equal(t, "flat", infos[2].Name)
+	}
+	assert.Equal(t, ThemeInfo{Name: "error"}, DescribeTheme(ErrorTheme{}))
+}
@@ -0,0 +1,208 @@
+package hermes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/inbucket/html2text"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidTextDirection is returned by New when the configured text
+// direction is neither TDLeftToRight nor TDRightToLeft
+var ErrInvalidTextDirection = errors.New("invalid text direction")
+
+// Renderer is a compiled hermes configuration.
+// It is created once with New and can then be used to render emails from
+// many goroutines at the same time: rendering never modifies the Renderer,
+// its configuration or the theme it was created with.
+type Renderer struct {
+	hermes    Hermes
+	html      *template.Template
+	plainText *template.Template
+	styles    StylesDefinition
+}
+
+// New checks the given configuration, applies the default values and resolves
+// the templates and styles of its theme once. The returned Renderer holds its
+// own copy of the configuration, later changes to config have no effect on it.
+func New(config Hermes) (*Renderer, error) {
+	switch config.TextDirection {
+	case "", TDLeftToRight, TDRightToLeft:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTextDirection, config.TextDirection)
+	}
+
+	err := setDefaultHermesValues(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	html, err := getHTMLTemplate(config.Theme)
+	if err != nil {
+		return nil, err
+	}
+	plainText, err := getPlainTextTemplate(config.Theme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Renderer{
+		hermes:    config,
+		html:      html,
+		plainText: plainText,
+		styles:    config.Theme.Styles().clone(),
+	}, nil
+}
+
+// Hermes returns a copy of the configuration the Renderer was created with,
+// default values included
+func (r *Renderer) Hermes() Hermes {
+	return r.hermes
+}
+
+// RenderHTML generates the email body from data to an HTML string
+// This is for modern email clients
+func (r *Renderer) RenderHTML(email Email) (string, error) {
+	var b strings.Builder
+	err := r.RenderHTMLTo(context.Background(), &b, email)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderText generates the plain text email body from data
+// This is for old email clients
+func (r *Renderer) RenderText(email Email) (string, error) {
+	var b strings.Builder
+	err := r.RenderTextTo(context.Background(), &b, email)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderHTMLTo generates the HTML email body and writes it to w.
+// The template output is never buffered as a whole: without CSS inlining it
+// is written as it is produced, with inlining it is parsed as it is produced
+// and written once inlined. Rendering stops with the context error as soon as
+// ctx is done; w may then have received part of the email.
+func (r *Renderer) RenderHTMLTo(ctx context.Context, w io.Writer, email Email) error {
+	email, err := r.prepare(email)
+	if err != nil {
+		return err
+	}
+	warnings, err := writeTemplate(ctx, w, r.hermes, email, r.html)
+	logWarnings(warnings)
+	return err
+}
+
+// RenderTextTo generates the plain text email body and writes it to w.
+// The template output is converted to text while it is produced. Rendering
+// stops with the context error as soon as ctx is done.
+func (r *Renderer) RenderTextTo(ctx context.Context, w io.Writer, email Email) error {
+	email, err := r.prepare(email)
+	if err != nil {
+		return err
+	}
+	return writePlainText(ctx, w, r.hermes, email, r.plainText)
+}
+
+// prepare applies the email defaults and logs the warnings raised doing so
+func (r *Renderer) prepare(email Email) (Email, error) {
+	email, warnings, err := prepareTemplateEmail(r.styles, email)
+	if err != nil {
+		return Email{}, err
+	}
+	logWarnings(warnings)
+	return email, nil
+}
+
+// logWarnings logs the warnings of the render methods not returning them
+func logWarnings(warnings []string) {
+	for _, w := range warnings {
+		logrus.Warn(w)
+	}
+}
+
+// Rendered is the result of Renderer.Render
+type Rendered struct {
+	HTML      string   // The HTML body, with CSS inlined unless disabled
+	Text      string   // The plain text body
+	Subject   string   // The subject of the email (Email.Subject, default to Body.Title)
+	Preheader string   // The inbox preview text of the email (Body.Preheader, default to the first intro)
+	Warnings  []string // Non fatal issues found while rendering (e.g. usage of deprecated fields, undefined CSS variables)
+}
+
+// Render generates the HTML and plain text bodies of the email in a single
+// pass: defaults are applied once and both bodies are generated from the same
+// email, so they can never disagree. Warnings are returned instead of logged.
+func (r *Renderer) Render(ctx context.Context, email Email) (*Rendered, error) {
+	email, warnings, err := prepareTemplateEmail(r.styles, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var html, text strings.Builder
+	cssWarnings, err := writeTemplate(ctx, &html, r.hermes, email, r.html)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, cssWarnings...)
+	err = writePlainText(ctx, &text, r.hermes, email, r.plainText)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rendered{
+		HTML:      html.String(),
+		Text:      text.String(),
+		Subject:   subject(email),
+		Preheader: email.Body.Preheader,
+		Warnings:  warnings,
+	}, nil
+}
+
+// toPlainText converts the result of a plain text template to plain text
+func toPlainText(s string) (string, error) {
+	return html2text.FromString(s, html2text.Options{PrettyTables: true})
+}
+
+// subject resolves the subject of the email
+func subject(email Email) string {
+	if email.Subject != "" {
+		return email.Subject
+	}
+	return email.Body.Title
+}
+
+// preheader derives the inbox preview text of the email from its first intro
+func preheader(email Email) string {
+	var intro string
+	switch {
+	case email.Body.IntrosMarkdown != "":
+		// Only keep the first paragraph of the intro
+		intro, _, _ = strings.Cut(string(email.Body.IntrosMarkdown.ToHTML()), "</p>")
+	case len(email.Body.IntrosUnsafe) > 0:
+		intro = string(email.Body.IntrosUnsafe[0])
+	case len(email.Body.Intros) > 0:
+		return strings.Join(strings.Fields(email.Body.Intros[0]), " ")
+	}
+
+	return textContent(intro)
+}
+
+var htmlTagRE = regexp.MustCompile(`<[^>]*>`)
+
+// textContent returns the text of an HTML fragment on a single line
+func textContent(fragment string) string {
+	text := html.UnescapeString(htmlTagRE.ReplaceAllString(fragment, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
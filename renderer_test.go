@@ -0,0 +1,319 @@
+package hermes
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sharedStylesTheme returns the same styles map on every call, like a custom
+// theme keeping its styles in a package variable would
+type sharedStylesTheme struct {
+	Default
+	styles StylesDefinition
+}
+
+func (st sharedStylesTheme) Styles() StylesDefinition {
+	return st.styles
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		r, err := New(Hermes{})
+		assert.NoError(t, err)
+		h := r.Hermes()
+		assert.Equal(t, TDLeftToRight, h.TextDirection)
+		assert.Equal(t, "default", h.Theme.Name())
+		assert.Equal(t, "Hermes", h.Product.Name)
+	})
+
+	t.Run("DoesNotModifyConfig", func(t *testing.T) {
+		config := Hermes{Product: Product{Name: "Custom App"}}
+		_, err := New(config)
+		assert.NoError(t, err)
+		assert.Nil(t, config.Theme)
+		assert.Empty(t, config.TextDirection)
+		assert.Empty(t, config.Product.Copyright)
+	})
+
+	t.Run("InvalidTextDirection", func(t *testing.T) {
+		r, err := New(Hermes{TextDirection: "not-existing"})
+		assert.ErrorIs(t, err, ErrInvalidTextDirection)
+		assert.Nil(t, r)
+	})
+
+	t.Run("InvalidThemeTemplate", func(t *testing.T) {
+		_, err := New(Hermes{Theme: ErrorTheme{}})
+		assert.Error(t, err)
+	})
+
+	t.Run("ParsedThemeError", func(t *testing.T) {
+		_, err := New(Hermes{Theme: ErrorParsedTheme{}})
+		assert.ErrorContains(t, err, "parsed HTML template error")
+	})
+}
+
+func TestRenderer_Render(t *testing.T) {
+	for i, theme := range testedThemes {
+		t.Run(fmt.Sprintf("%s-%d", theme.Name(), i), func(t *testing.T) {
+			ex := SimpleExample{theme}
+			h, email := ex.getExample()
+			r, err := New(h)
+			assert.NoError(t, err)
+
+			html, err := r.RenderHTML(email)
+			if assert.NoError(t, err) {
+				ex.assertHTMLContent(t, html)
+			}
+			text, err := r.RenderText(email)
+			if assert.NoError(t, err) {
+				ex.assertPlainTextContent(t, text)
+			}
+		})
+	}
+}
+
+func TestRenderer_DoesNotModifyThemeOrEmail(t *testing.T) {
+	theme := sharedStylesTheme{styles: StylesDefinition{
+		".email-body_inner": {"width": "570px"},
+		"body":              {"color": "#000"},
+	}}
+	r, err := New(Hermes{Theme: theme, DisableCSSInlining: true})
+	assert.NoError(t, err)
+
+	overrides := map[string]any{"body_width": "800px"}
+	email := Email{Body: Body{
+		Name:              "Jon Snow",
+		CSS:               StylesDefinition{"body": {"color": "#FF0000"}},
+		TemplateOverrides: overrides,
+	}}
+	html, err := r.RenderHTML(email)
+	assert.NoError(t, err)
+	assert.Contains(t, html, "color: #FF0000")
+	assert.Contains(t, html, "width: 800px")
+
+	assert.Equal(t, "570px", theme.styles[".email-body_inner"]["width"])
+	assert.Equal(t, "#000", theme.styles["body"]["color"])
+	assert.Equal(t, map[string]any{"body_width": "800px"}, overrides)
+	assert.Empty(t, email.Body.Intros)
+}
+
+func TestRenderer_Concurrent(t *testing.T) {
+	h, email := SimpleExamplePremailer{new(Default)}.getExample()
+	email.Body.CSS = StylesDefinition{"body": {"color": "#123456"}}
+	r, err := New(h)
+	assert.NoError(t, err)
+
+	want, err := r.RenderHTML(email)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			html, err := r.RenderHTML(email)
+			assert.NoError(t, err)
+			assert.Equal(t, want, html)
+			_, err = r.RenderText(email)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRenderer_RenderSinglePass(t *testing.T) {
+	for i, theme := range testedThemes {
+		t.Run(fmt.Sprintf("%s-%d", theme.Name(), i), func(t *testing.T) {
+			ex := SimpleExample{theme}
+			h, email := ex.getExample()
+			r, err := New(h)
+			assert.NoError(t, err)
+
+			res, err := r.Render(context.Background(), email)
+			if !assert.NoError(t, err) {
+				return
+			}
+			ex.assertHTMLContent(t, res.HTML)
+			ex.assertPlainTextContent(t, res.Text)
+			assert.Equal(t, "Welcome to Hermes! We're very excited to have you on board.", res.Preheader)
+			assert.Empty(t, res.Subject)
+			assert.Equal(t, []string{"Email.Body.Table field is deprecated, please use Email.Body.Tables instead"}, res.Warnings)
+
+			// Both bodies match what the dedicated methods generate
+			html, err := r.RenderHTML(email)
+			assert.NoError(t, err)
+			assert.Equal(t, html, res.HTML)
+			text, err := r.RenderText(email)
+			assert.NoError(t, err)
+			assert.Equal(t, text, res.Text)
+		})
+	}
+}
+
+func TestRenderer_RenderSubjectAndPreheader(t *testing.T) {
+	r, err := New(Hermes{DisableCSSInlining: true})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		email     Email
+		subject   string
+		preheader string
+	}{
+		{
+			name:  "empty",
+			email: Email{},
+		},
+		{
+			name:    "subject from title",
+			email:   Email{Body: Body{Title: "Your receipt"}},
+			subject: "Your receipt",
+		},
+		{
+			name:    "explicit subject",
+			email:   Email{Subject: "Welcome!", Body: Body{Title: "Your receipt"}},
+			subject: "Welcome!",
+		},
+		{
+			name:      "preheader from unsafe intro",
+			email:     Email{Body: Body{IntrosUnsafe: []template.HTML{"Your <b>order</b>   shipped", "Second"}}},
+			preheader: "Your order shipped",
+		},
+		{
+			name:      "preheader from markdown intro",
+			email:     Email{Body: Body{IntrosMarkdown: "First *paragraph*\nstill first\n\nSecond paragraph"}},
+			preheader: "First paragraph still first",
+		},
+		{
+			name:      "explicit preheader",
+			email:     Email{Body: Body{Preheader: "Your order is on its way", Intros: []string{"Hi"}}},
+			preheader: "Your order is on its way",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := r.Render(context.Background(), tt.email)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.subject, res.Subject)
+				assert.Equal(t, tt.preheader, res.Preheader)
+				assert.Empty(t, res.Warnings)
+				if tt.preheader != "" {
+					assert.Contains(t, res.HTML, `<div class="email-preheader" style="display: none;`)
+					assert.Contains(t, res.HTML, tt.preheader+"&#847;&zwnj;&nbsp;")
+					assert.NotContains(t, res.Text, "\u034f", "The padding should be left out of the plain text")
+				} else {
+					assert.NotContains(t, res.HTML, "email-preheader")
+				}
+			}
+		})
+	}
+}
+
+func TestRenderer_RenderCanceled(t *testing.T) {
+	r, err := New(Hermes{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := r.Render(ctx, Email{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, res)
+}
+
+// cancelWriter cancels its context once it has received limit bytes and
+// records the first write it received
+type cancelWriter struct {
+	strings.Builder
+	limit  int
+	cancel context.CancelFunc
+	first  string
+}
+
+func (cw *cancelWriter) Write(p []byte) (int, error) {
+	if cw.Len() == 0 {
+		cw.first = string(p)
+	}
+	n, err := cw.Builder.Write(p)
+	if cw.Len() >= cw.limit {
+		cw.cancel()
+	}
+	return n, err
+}
+
+func TestRenderer_RenderTo(t *testing.T) {
+	for _, inlining := range []bool{true, false} {
+		t.Run(fmt.Sprintf("inlining-%t", inlining), func(t *testing.T) {
+			h, email := SimpleExample{new(Default)}.getExample()
+			h.DisableCSSInlining = !inlining
+			r, err := New(h)
+			assert.NoError(t, err)
+
+			var html strings.Builder
+			err = r.RenderHTMLTo(context.Background(), &html, email)
+			assert.NoError(t, err)
+			want, err := r.RenderHTML(email)
+			assert.NoError(t, err)
+			assert.Equal(t, want, html.String())
+
+			// Plain text matches what Hermes generates
+			var text strings.Builder
+			err = r.RenderTextTo(context.Background(), &text, email)
+			assert.NoError(t, err)
+			want, err = h.GeneratePlainText(email)
+			assert.NoError(t, err)
+			assert.Equal(t, want, text.String())
+		})
+	}
+}
+
+func TestRenderer_RenderToCanceled(t *testing.T) {
+	h, email := SimpleExample{new(Default)}.getExample()
+	r, err := New(h)
+	assert.NoError(t, err)
+	full, err := r.RenderHTML(email)
+	assert.NoError(t, err)
+
+	t.Run("StopsStreaming", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w := &cancelWriter{limit: 1, cancel: cancel}
+		err := r.RenderHTMLTo(ctx, w, email)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotEmpty(t, w.String())
+		assert.Less(t, w.Len(), len(full))
+		assert.NotContains(t, w.first, "</html>", "The output should be written before the template is done")
+
+		// The whole email is written in as many pieces as the template produces
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		w = &cancelWriter{limit: len(full) + 1, cancel: cancel}
+		err = r.RenderHTMLTo(ctx, w, email)
+		assert.NoError(t, err)
+		assert.Equal(t, full, w.String())
+		assert.Less(t, len(w.first), len(full))
+	})
+
+	t.Run("StopsInlining", func(t *testing.T) {
+		h := h
+		h.DisableCSSInlining = false
+		r, err := New(h)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var w strings.Builder
+		err = r.RenderHTMLTo(ctx, &w, email)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, w.String())
+
+		err = r.RenderTextTo(ctx, &w, email)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, w.String())
+	})
+}
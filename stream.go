@@ -0,0 +1,85 @@
+package hermes
+
+import (
+	"context"
+	"html/template"
+	"io"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/inbucket/html2text"
+	"golang.org/x/net/html"
+)
+
+// ctxWriter is an io.Writer that stops writing once its context is done
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// pipeTemplate executes t in its own goroutine and returns a reader streaming
+// the output as it is produced. The reader must be closed by the caller.
+func pipeTemplate(ctx context.Context, h Hermes, email Email, t *template.Template) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(t.Execute(&ctxWriter{ctx, pw}, Template{h, email}))
+	}()
+	return pr
+}
+
+// writeTemplate executes t with an email already prepared by
+// prepareTemplateEmail and writes the result to w, inlining its CSS unless
+// disabled. Without inlining, the output is written as the template produces
+// it; otherwise the document is parsed while the template is executed, its
+// CSS variables are resolved and it is written once inlined. It returns the
+// warnings raised doing so (e.g. undefined CSS variables).
+func writeTemplate(ctx context.Context, w io.Writer, h Hermes, email Email, t *template.Template) ([]string, error) {
+	w = &ctxWriter{ctx, w}
+	if h.DisableCSSInlining {
+		return nil, t.Execute(w, Template{h, email})
+	}
+
+	r := pipeTemplate(ctx, h, email, t)
+	defer r.Close()
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	warnings := resolveCSSVariables(doc)
+
+	// Inlining CSS
+	inliner := h.Inliner
+	if inliner == nil {
+		inliner = PremailerInliner{}
+	}
+	res, err := inliner.Inline(doc)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(w, res)
+	return warnings, err
+}
+
+// writePlainText executes the plain text template t and writes its text
+// conversion to w. The template output is converted while it is produced.
+func writePlainText(ctx context.Context, w io.Writer, h Hermes, email Email, t *template.Template) error {
+	r := pipeTemplate(ctx, h, email, t)
+	defer r.Close()
+	doc, err := html.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	text, err := html2text.FromHTMLNode(doc, html2text.Options{PrettyTables: true})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(&ctxWriter{ctx, w}, text)
+	return err
+}
@@ -11,6 +11,7 @@ import (
 // - Does not support nested rules, media queries, or at-rules (they should be injected separately)
 // - Multiple selectors separated by commas are split and each receives the full property set
 // Consumers can use this to transform their custom CSS overrides into a StylesDefinition for merging.
+// Use ParseStylesheet to keep the order of the rules and the at-rules of the CSS.
 func ParseStylesDefinition(css string) StylesDefinition {
 	styles := StylesDefinition{}
 
@@ -0,0 +1,421 @@
+package hermes
+
+import (
+	"fmt"
+	"html/template"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Stylesheet is a CSS stylesheet which, unlike StylesDefinition, keeps the
+// order of its rules and declarations, and its at-rules
+type Stylesheet []Rule
+
+// Rule is a rule of a stylesheet: a style rule, e.g. p.sub { font-size: 12px },
+// or an at-rule, e.g. @media, @supports, @font-face or @import
+type Rule struct {
+	// Selector is the selector of a style rule, or the at-keyword and the
+	// prelude of an at-rule, e.g. "@media only screen and (max-width: 500px)"
+	Selector     string
+	Declarations []Declaration // Declarations of the rule, e.g. of a style rule or of @font-face
+	Rules        []Rule        // Nested rules, e.g. of @media or @supports
+}
+
+// Declaration is a declaration of a rule, e.g. color: #ffffff !important
+type Declaration struct {
+	Property  string
+	Value     string // Value of the property, without !important
+	Important bool
+}
+
+// StylesheetTheme is implemented by themes providing their styles as a
+// stylesheet, whose order and at-rules are kept in HTML emails
+type StylesheetTheme interface {
+	Stylesheet() Stylesheet
+}
+
+var importantRE = regexp.MustCompile(`(?i)\s*!\s*important$`)
+
+// ParseStylesheet parses CSS into a stylesheet. Comments are removed, and
+// empty at-rules such as @media print {} are dropped.
+func ParseStylesheet(css string) Stylesheet {
+	p := &cssParser{css: stripComments(css)}
+	var sheet Stylesheet
+	for p.pos < len(p.css) {
+		// Declarations are ignored at the top level, as are unbalanced }
+		_, rules := p.block()
+		sheet = append(sheet, rules...)
+	}
+	return sheet
+}
+
+// parseDeclarations parses the declarations of a rule or of a style attribute,
+// e.g. color: #ffffff; font-size: 12px
+func parseDeclarations(css string) []Declaration {
+	p := &cssParser{css: stripComments(css)}
+	decls, _ := p.block()
+	return decls
+}
+
+// Styles returns the style rules of the stylesheet as a StylesDefinition,
+// without its at-rules. The selectors of a selector list get the declarations
+// of the rule each, and the declarations of later rules win.
+func (s Stylesheet) Styles() StylesDefinition {
+	styles := StylesDefinition{}
+	for _, r := range s {
+		if r.IsAtRule() {
+			continue
+		}
+		for _, sel := range splitSelectors(r.Selector) {
+			if styles[sel] == nil {
+				styles[sel] = map[string]any{}
+			}
+			for _, d := range r.Declarations {
+				value := d.Value
+				if d.Important {
+					value += " !important"
+				}
+				styles[sel][d.Property] = value
+			}
+		}
+	}
+	return styles
+}
+
+// Stylesheet returns the styles as a stylesheet, with sorted selectors and properties
+func (s StylesDefinition) Stylesheet() Stylesheet {
+	return Stylesheet(nil).WithStyles(s)
+}
+
+// WithStyles returns a copy of the stylesheet holding styles. The style rules
+// of the stylesheet get the declarations of their selector in styles, in
+// their order first, and are removed when left without declarations. When a
+// selector has several rules, each property goes to the last of them
+// declaring it, and the properties none declares to the last of them, so that
+// the rules keep their place in the cascade.
+// The selectors only found in styles are appended, sorted. At-rules are kept.
+func (s Stylesheet) WithStyles(styles StylesDefinition) Stylesheet {
+	count := map[string]int{}               // Rules of each selector
+	declared := map[string]map[string]int{} // Last rule of each selector declaring a property
+	for _, r := range s {
+		if r.IsAtRule() {
+			continue
+		}
+		for _, sel := range splitSelectors(r.Selector) {
+			if declared[sel] == nil {
+				declared[sel] = map[string]int{}
+			}
+			for _, d := range r.Declarations {
+				declared[sel][d.Property] = count[sel]
+			}
+			count[sel]++
+		}
+	}
+
+	sheet := make(Stylesheet, 0, len(s))
+	seen := map[string]int{}
+	for _, r := range s {
+		if r.IsAtRule() {
+			sheet = append(sheet, r.clone())
+			continue
+		}
+		for _, sel := range splitSelectors(r.Selector) {
+			n := seen[sel]
+			seen[sel]++
+			props := map[string]any{}
+			for property, value := range styles[sel] {
+				i, ok := declared[sel][property]
+				if (ok && i == n) || (!ok && n == count[sel]-1) {
+					props[property] = value
+				}
+			}
+			if decls := declarations(props, r.Declarations); len(decls) > 0 {
+				sheet = append(sheet, Rule{Selector: sel, Declarations: decls})
+			}
+		}
+	}
+	for _, sel := range slices.Sorted(maps.Keys(styles)) {
+		if count[sel] > 0 {
+			continue
+		}
+		if decls := declarations(styles[sel], nil); len(decls) > 0 {
+			sheet = append(sheet, Rule{Selector: sel, Declarations: decls})
+		}
+	}
+	return sheet
+}
+
+// String returns the stylesheet as CSS
+func (s Stylesheet) String() string {
+	var b strings.Builder
+	writeRules(&b, s, "")
+	return b.String()
+}
+
+// IsAtRule tells whether the rule is an at-rule, e.g. @media
+func (r Rule) IsAtRule() bool {
+	return strings.HasPrefix(r.Selector, "@")
+}
+
+// clone returns a deep copy of r
+func (r Rule) clone() Rule {
+	r.Declarations = slices.Clone(r.Declarations)
+	if r.Rules != nil {
+		rules := make([]Rule, len(r.Rules))
+		for i, nested := range r.Rules {
+			rules[i] = nested.clone()
+		}
+		r.Rules = rules
+	}
+	return r
+}
+
+// newDeclaration returns the declaration of property, marked important when value ends with !important
+func newDeclaration(property, value string) Declaration {
+	d := Declaration{Property: property, Value: importantRE.ReplaceAllString(value, "")}
+	d.Important = len(d.Value) < len(value)
+	return d
+}
+
+// String returns the declaration as CSS, without the trailing semicolon
+func (d Declaration) String() string {
+	if d.Important {
+		return d.Property + ": " + d.Value + " !important"
+	}
+	return d.Property + ": " + d.Value
+}
+
+// clone returns a deep copy of s
+func (s Stylesheet) clone() Stylesheet {
+	if s == nil {
+		return nil
+	}
+	sheet := make(Stylesheet, len(s))
+	for i, r := range s {
+		sheet[i] = r.clone()
+	}
+	return sheet
+}
+
+func writeRules(b *strings.Builder, rules []Rule, indent string) {
+	for i, r := range rules {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if r.IsAtRule() && r.Declarations == nil && r.Rules == nil {
+			// Statement at-rule, e.g. @import
+			fmt.Fprintf(b, "%s%s;\n", indent, r.Selector)
+			continue
+		}
+		fmt.Fprintf(b, "%s%s {\n", indent, r.Selector)
+		for _, d := range r.Declarations {
+			fmt.Fprintf(b, "%s  %s;\n", indent, d)
+		}
+		if len(r.Declarations) > 0 && len(r.Rules) > 0 {
+			b.WriteString("\n")
+		}
+		writeRules(b, r.Rules, indent+"  ")
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+}
+
+// declarations returns the declarations of props, in the order of the
+// properties of order first, and then sorted
+func declarations(props map[string]any, order []Declaration) []Declaration {
+	decls := make([]Declaration, 0, len(props))
+	done := map[string]bool{}
+	add := func(property string) {
+		if done[property] {
+			return
+		}
+		done[property] = true
+		var value string
+		switch v := props[property].(type) {
+		case nil, unset:
+			return
+		case string:
+			value = v
+		case Important:
+			value = string(v) + " !important"
+		default:
+			value = fmt.Sprint(v)
+		}
+		decls = append(decls, newDeclaration(property, value))
+	}
+	for _, d := range order {
+		if _, ok := props[d.Property]; ok {
+			add(d.Property)
+		}
+	}
+	for _, property := range slices.Sorted(maps.Keys(props)) {
+		add(property)
+	}
+	return decls
+}
+
+// emailStylesheet returns the styles of an email, in the order of the
+// stylesheet of theme when it has one
+func emailStylesheet(theme Theme, styles StylesDefinition) Stylesheet {
+	var sheet Stylesheet
+	if t, ok := theme.(StylesheetTheme); ok {
+		sheet = t.Stylesheet()
+	}
+	return sheet.WithStyles(styles)
+}
+
+// isPreserved tells whether the rule must be kept from premailer, which only
+// supports style rules and @media, and breaks other at-rules such as @font-face
+func (r Rule) isPreserved() bool {
+	return r.IsAtRule() && !strings.HasPrefix(strings.ToLower(r.Selector), "@media")
+}
+
+// renderStylesheet renders the style rules and @media rules of the styles of
+// an email, inlined by premailer
+func renderStylesheet(theme Theme, styles StylesDefinition) template.CSS {
+	sheet := slices.DeleteFunc(emailStylesheet(theme, styles), Rule.isPreserved)
+	return cssContent(sheet)
+}
+
+// renderPreservedStylesheet renders the other at-rules of the styles of an
+// email, e.g. @import or @font-face, to be kept from premailer
+func renderPreservedStylesheet(theme Theme, styles StylesDefinition) template.CSS {
+	sheet := slices.DeleteFunc(emailStylesheet(theme, styles), func(r Rule) bool { return !r.isPreserved() })
+	return cssContent(sheet)
+}
+
+// cssContent returns the stylesheet as the content of a <style> element
+func cssContent(sheet Stylesheet) template.CSS {
+	// The stylesheet must not close the <style> element it is rendered in
+	return template.CSS(strings.ReplaceAll(sheet.String(), "</", `<\/`))
+}
+
+// cssParser parses CSS without comments
+type cssParser struct {
+	css string
+	pos int
+}
+
+// block parses the declarations and rules up to the end of the current
+// block, whose closing brace is consumed, or up to the end of the input
+func (p *cssParser) block() (decls []Declaration, rules []Rule) {
+	for {
+		text, end := p.next()
+		if end == '{' {
+			nestedDecls, nestedRules := p.block()
+			if !strings.HasPrefix(text, "@") || nestedDecls != nil || nestedRules != nil {
+				rules = append(rules, Rule{Selector: text, Declarations: nestedDecls, Rules: nestedRules})
+			}
+			continue
+		}
+
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "@"):
+			rules = append(rules, Rule{Selector: text})
+		default:
+			if property, value, ok := strings.Cut(text, ":"); ok && strings.TrimSpace(property) != "" {
+				decls = append(decls, newDeclaration(strings.TrimSpace(property), strings.TrimSpace(value)))
+			}
+		}
+		if end != ';' {
+			return decls, rules
+		}
+	}
+}
+
+// next returns the text up to the next {, } or ; outside of strings and
+// parentheses, along with that delimiter, or 0 at the end of the input
+func (p *cssParser) next() (string, byte) {
+	start := p.pos
+	var quote byte
+	depth := 0
+	for ; p.pos < len(p.css); p.pos++ {
+		c := p.css[p.pos]
+		switch {
+		case c == '\\':
+			p.pos++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth <= 0 && (c == '{' || c == '}' || c == ';'):
+			p.pos++
+			return strings.TrimSpace(p.css[start : p.pos-1]), c
+		}
+	}
+	return strings.TrimSpace(p.css[start:]), 0
+}
+
+// stripComments removes the comments of css, outside of strings
+func stripComments(css string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '\\' && i+1 < len(css):
+			b.WriteByte(c)
+			i++
+			c = css[i]
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// splitSelectors splits a selector list, e.g. "h1, h2:is(.a, .b)", into its selectors
+func splitSelectors(list string) []string {
+	var selectors []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			selectors = append(selectors, list[start:i])
+			start = i + 1
+		}
+	}
+	selectors = append(selectors, list[start:])
+
+	out := selectors[:0]
+	for _, sel := range selectors {
+		if sel = strings.TrimSpace(sel); sel != "" {
+			out = append(out, sel)
+		}
+	}
+	return out
+}
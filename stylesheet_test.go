@@ -0,0 +1,179 @@
+package hermes
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const stylesheetCSS = `@import url("https://fonts.example.com/inter.css");
+
+/* Fonts */
+@font-face {
+  font-family: Inter;
+  src: url("inter.woff2") format("woff2");
+}
+
+*:not(br):not(tr):not(html) {
+  font-family: Inter, sans-serif;
+}
+
+body, td {
+  color: #333333;
+  background: url("data:image/png;base64,a;b{c}");
+}
+
+a::after {
+  content: "} /* not a comment */";
+}
+
+@media only screen and (max-width: 500px) {
+  .button {
+    width: 100% !important;
+  }
+}
+
+@supports (display: grid) {
+  @media screen {
+    .grid {
+      display: grid;
+    }
+  }
+}
+
+@media print {}
+`
+
+func TestParseStylesheet(t *testing.T) {
+	sheet := ParseStylesheet(stylesheetCSS)
+	if !assert.Len(t, sheet, 7) {
+		return
+	}
+	assert.Equal(t, Rule{Selector: `@import url("https://fonts.example.com/inter.css")`}, sheet[0])
+	assert.Equal(t, Rule{Selector: "@font-face", Declarations: []Declaration{
+		{Property: "font-family", Value: "Inter"},
+		{Property: "src", Value: `url("inter.woff2") format("woff2")`},
+	}}, sheet[1])
+	assert.Equal(t, "*:not(br):not(tr):not(html)", sheet[2].Selector)
+	assert.Equal(t, []Declaration{
+		{Property: "color", Value: "#333333"},
+		{Property: "background", Value: `url("data:image/png;base64,a;b{c}")`},
+	}, sheet[3].Declarations, "Strings should be kept")
+	assert.Equal(t, `"} /* not a comment */"`, sheet[4].Declarations[0].Value)
+	assert.Equal(t, Rule{Selector: "@media only screen and (max-width: 500px)", Rules: []Rule{
+		{Selector: ".button", Declarations: []Declaration{{Property: "width", Value: "100%", Important: true}}},
+	}}, sheet[5])
+	assert.Equal(t, "@supports (display: grid)", sheet[6].Selector)
+	assert.Equal(t, ".grid", sheet[6].Rules[0].Rules[0].Selector)
+	assert.NotContains(t, sheet.String(), "@media print", "Empty at-rules should be dropped")
+
+	// Round trip
+	assert.Equal(t, sheet, ParseStylesheet(sheet.String()))
+	assert.Contains(t, sheet.String(), "@media only screen and (max-width: 500px) {\n  .button {\n    width: 100% !important;\n  }\n}\n")
+
+	assert.Empty(t, ParseStylesheet(""))
+	assert.Empty(t, ParseStylesheet("/* only a comment */"))
+	assert.Equal(t, Stylesheet{{Selector: "p", Declarations: []Declaration{{Property: "color", Value: "red"}}}},
+		ParseStylesheet("} p { color: red; missing colon; }"), "Invalid declarations should be ignored")
+}
+
+func TestStylesheet_Styles(t *testing.T) {
+	styles := ParseStylesheet(stylesheetCSS + "td { color: #000000; padding: 0 !important }").Styles()
+	assert.Equal(t, StylesDefinition{
+		"*:not(br):not(tr):not(html)": {"font-family": "Inter, sans-serif"},
+		"body":                        {"color": "#333333", "background": `url("data:image/png;base64,a;b{c}")`},
+		"td":                          {"color": "#000000", "background": `url("data:image/png;base64,a;b{c}")`, "padding": "0 !important"},
+		"a::after":                    {"content": `"} /* not a comment */"`},
+	}, styles, "At-rules should be left out and later rules should win")
+
+	assert.Equal(t, GetDefaultStyles(), Default{}.Stylesheet().Styles())
+	assert.Equal(t, styles, styles.Stylesheet().Styles())
+}
+
+func TestStylesheet_WithStyles(t *testing.T) {
+	sheet := ParseStylesheet(stylesheetCSS).WithStyles(StylesDefinition{
+		"body":   {"color": "#000000", "margin": 0, "background": nil},
+		"td":     {"color": "#333333"},
+		".extra": {"color": "red"},
+	})
+	assert.Equal(t, `@import url("https://fonts.example.com/inter.css");
+
+@font-face {
+  font-family: Inter;
+  src: url("inter.woff2") format("woff2");
+}
+
+body {
+  color: #000000;
+  margin: 0;
+}
+
+td {
+  color: #333333;
+}
+
+@media only screen and (max-width: 500px) {
+  .button {
+    width: 100% !important;
+  }
+}
+
+@supports (display: grid) {
+  @media screen {
+    .grid {
+      display: grid;
+    }
+  }
+}
+
+.extra {
+  color: red;
+}
+`, sheet.String())
+
+	assert.Equal(t, ".a", StylesDefinition{".b": {}, ".a": {"z-index": "1", "color": "red"}}.Stylesheet()[0].Selector, "Selectors should be sorted")
+
+	// Repeated selectors keep their rules, in source order
+	repeated := ParseStylesheet("a { color: red; font-weight: bold; }\np { color: blue; }\na { color: green; }")
+	assert.Equal(t, "a {\n  font-weight: bold;\n}\n\np {\n  color: blue;\n}\n\na {\n  color: green;\n}\n",
+		repeated.WithStyles(repeated.Styles()).String(), "Each property should stay in the last rule declaring it")
+	assert.Equal(t, "a {\n  font-weight: normal;\n}\n\na {\n  color: green;\n  margin: 0;\n}\n",
+		repeated.WithStyles(StylesDefinition{"a": {"color": "green", "font-weight": "normal", "margin": 0}}).String(),
+		"New properties should go to the last rule of their selector")
+}
+
+func TestRenderStylesheet(t *testing.T) {
+	html := renderTheme(t, new(Default), extendEmail).HTML
+	assert.NotContains(t, html, "ZgotmplZ")
+	star := strings.Index(html, "*:not(br):not(tr):not(html) {")
+	cite := strings.Index(html, "cite:before {")
+	if assert.True(t, star >= 0 && cite >= 0, "Non inlined rules should be kept") {
+		assert.Less(t, star, cite, "Rules should keep the order of the theme")
+	}
+
+	// At-rules of themes loaded from files are kept
+	fsys := defaultThemeFS(t, "themes/fonts")
+	css := string(fsys["themes/fonts/"+ThemeCSSFile].Data)
+	fsys["themes/fonts/"+ThemeCSSFile] = &fstest.MapFile{Data: []byte(css + `
+@font-face { font-family: Inter; src: url("inter.woff2"); }
+@media only screen and (max-width: 320px) { .email-masthead { padding: 0; } }
+`)}
+	theme, err := LoadTheme(fsys, "themes/fonts")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, GetDefaultStyles(), theme.Styles())
+	html = renderTheme(t, theme, extendEmail).HTML
+	assert.Contains(t, html, "<style type=\"text/css\" data-premailer=\"ignore\">\n            @font-face {\n  font-family: Inter;", "At-rules other than @media should be kept from premailer")
+	assert.Contains(t, html, "@media only screen and (max-width: 320px)")
+
+	// So are the ones of the extended themes
+	extended, err := ExtendTheme(theme, ThemeExtension{Name: "brand", Styles: StylesDefinition{".brand": {"color": "red"}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, renderTheme(t, extended, extendEmail).HTML, "@font-face {")
+	assert.Equal(t, "@font-face", extended.(StylesheetTheme).Stylesheet()[len(Default{}.Stylesheet())].Selector)
+}
@@ -0,0 +1,160 @@
+package hermes
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tokens are the design values the styles of a theme are derived from, so
+// that a brand only has to maintain a handful of values. Empty tokens keep the
+// values of the styles they are applied to.
+type Tokens struct {
+	Primary    string `json:"primary,omitempty"`     // Color of buttons, links and info alerts (default to #3869d4)
+	Accent     string `json:"accent,omitempty"`      // Color of headings and of the product name (default to #2f3133)
+	Background string `json:"background,omitempty"`  // Color around the email body (default to #f2f4f6)
+	Text       string `json:"text,omitempty"`        // Color of the text (default to #74787e)
+	FontFamily string `json:"font_family,omitempty"` // Font stack of the text
+	Radius     string `json:"radius,omitempty"`      // Radius of the corners of buttons and invite codes (default to 3px)
+	// Spacing is the unit of the spacing scale in pixels, the paddings and
+	// margins of the email being multiples of it (default to 5)
+	Spacing int `json:"spacing,omitempty"`
+	// Dark is the palette of the email in dark mode, see Hermes.DarkMode
+	Dark DarkPalette `json:"dark"`
+}
+
+// DarkPalette is the colors of an email displayed in dark mode
+type DarkPalette struct {
+	Primary    string `json:"primary,omitempty"`    // Color of buttons and links (default to Tokens.Primary)
+	Accent     string `json:"accent,omitempty"`     // Color of headings and of the product name (default to #f5f5f5)
+	Background string `json:"background,omitempty"` // Color around the email body (default to #111111)
+	Surface    string `json:"surface,omitempty"`    // Color of the email body (default to #1e1e1e)
+	Text       string `json:"text,omitempty"`       // Color of the text (default to #d4d4d4)
+}
+
+// TokenizedTheme is implemented by themes derived from design tokens
+type TokenizedTheme interface {
+	Tokens() Tokens
+}
+
+// Styles returns the styles of the default theme with the tokens applied
+func (t Tokens) Styles() StylesDefinition {
+	return t.applyTo(GetDefaultStyles())
+}
+
+// over returns t, with its empty tokens taken from base
+func (t Tokens) over(base Tokens) Tokens {
+	return Tokens{
+		Primary:    cmp.Or(t.Primary, base.Primary),
+		Accent:     cmp.Or(t.Accent, base.Accent),
+		Background: cmp.Or(t.Background, base.Background),
+		Text:       cmp.Or(t.Text, base.Text),
+		FontFamily: cmp.Or(t.FontFamily, base.FontFamily),
+		Radius:     cmp.Or(t.Radius, base.Radius),
+		Spacing:    cmp.Or(t.Spacing, base.Spacing),
+		Dark: DarkPalette{
+			Primary:    cmp.Or(t.Dark.Primary, base.Dark.Primary),
+			Accent:     cmp.Or(t.Dark.Accent, base.Dark.Accent),
+			Background: cmp.Or(t.Dark.Background, base.Dark.Background),
+			Surface:    cmp.Or(t.Dark.Surface, base.Dark.Surface),
+			Text:       cmp.Or(t.Dark.Text, base.Dark.Text),
+		},
+	}
+}
+
+// applyTo sets the properties derived from the tokens in styles and returns
+// styles. The dark palette is rendered by the templates, see Hermes.DarkMode.
+func (t Tokens) applyTo(styles StylesDefinition) StylesDefinition {
+	set := func(value, property string, selectors ...string) {
+		if value == "" {
+			return
+		}
+		for _, sel := range selectors {
+			if styles[sel] == nil {
+				styles[sel] = map[string]any{}
+			}
+			styles[sel][property] = value
+		}
+	}
+
+	set(t.Primary, "color", "a")
+	set(t.Primary, "background-color", ".button")
+	if t.Primary != "" {
+		// Info alerts are a light tint of the primary color, or neutral when
+		// the tint cannot be computed, e.g. for named colors
+		set(t.Primary, "border-color", ".body-alert--info")
+		set(cmp.Or(tint(t.Primary, 0.08), "#f2f4f6"), "background-color", ".body-alert--info")
+	}
+	set(t.Accent, "color", "h1", "h2", "h3", ".email-masthead_name")
+	set(t.Background, "background-color", "body", ".email-wrapper")
+	if t.Background != "" {
+		// The footer is displayed on the background
+		footer := "#aeaeae"
+		if isDark(t.Background) {
+			footer = "#eaeaea"
+		}
+		set(footer, "color", ".email-footer p")
+	}
+	set(t.Text, "color", "body", "p", "td", ".data-table td", ".table-footer")
+	set(t.FontFamily, "font-family", "*:not(br):not(tr):not(html)")
+	set(t.Radius, "border-radius", ".button", ".invite-code", ".invite-code-cell", ".body-card", ".body-card_button", ".body-alert")
+	if t.Spacing > 0 {
+		px := func(n int) string { return strconv.Itoa(n*t.Spacing) + "px" }
+		set(px(5)+" 0", "padding", ".email-masthead")
+		set(px(7), "padding", ".content-cell")
+		set(px(7)+" 0", "padding", ".data-wrapper")
+		set(px(4)+" auto "+px(2), "margin", ".body-dictionary")
+		set(px(6)+" auto", "margin", ".body-action", ".vml-button-wrapper")
+		set(px(6), "margin-top", ".invite-code-container")
+		set(px(6), "margin-bottom", ".invite-code-container")
+		set(px(5), "margin-top", ".body-sub")
+		set(px(5), "padding-top", ".body-sub")
+		set(px(5)+" 0", "margin", ".body-divider")
+	}
+	return styles
+}
+
+// themeTokens returns the tokens of theme, completed with the default ones
+func themeTokens(theme Theme) Tokens {
+	if t, ok := theme.(TokenizedTheme); ok {
+		return t.Tokens().over(Default{}.Tokens())
+	}
+	return Default{}.Tokens()
+}
+
+// isDark tells whether color is a dark hexadecimal color, e.g. #2c3e50
+func isDark(color string) bool {
+	r, g, b, ok := parseHexColor(color)
+	// Perceived brightness, see https://www.w3.org/TR/AERT/#color-contrast
+	return ok && (r*299+g*587+b*114)/1000 < 128
+}
+
+// tint returns the hexadecimal color, e.g. #eff3fc, mixing amount of color
+// with white, or "" when color is not a hexadecimal color
+func tint(color string, amount float64) string {
+	r, g, b, ok := parseHexColor(color)
+	if !ok {
+		return ""
+	}
+	mix := func(c uint64) uint64 { return uint64(math.Round(255 - (255-float64(c))*amount)) }
+	return fmt.Sprintf("#%02x%02x%02x", mix(r), mix(g), mix(b))
+}
+
+// parseHexColor returns the components of a hexadecimal color, e.g. #2c3e50
+// or #fff
+func parseHexColor(color string) (r, g, b uint64, ok bool) {
+	hex, ok := strings.CutPrefix(color, "#")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return 0, 0, 0, false
+	}
+	return rgb >> 16, rgb >> 8 & 0xff, rgb & 0xff, true
+}
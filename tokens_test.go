@@ -0,0 +1,141 @@
+package hermes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens_Styles(t *testing.T) {
+	assert.Equal(t, GetDefaultStyles(), Default{}.Tokens().Styles(), "Default tokens should match the default styles")
+	assert.Equal(t, GetDefaultStyles(), Tokens{}.Styles(), "Empty tokens should keep the styles")
+
+	styles := Tokens{
+		Primary:    "#ff6600",
+		Accent:     "#111111",
+		Background: "#ffffff",
+		Text:       "#222222",
+		FontFamily: "Georgia, serif",
+		Radius:     "8px",
+		Spacing:    4,
+	}.Styles()
+	assert.Equal(t, "#ff6600", styles["a"]["color"])
+	assert.Equal(t, "#ff6600", styles[".button"]["background-color"])
+	assert.Equal(t, "#fff3eb", styles[".body-alert--info"]["background-color"], "Info alerts should be tinted with the primary color")
+	assert.Equal(t, "#f2f4f6", Tokens{Primary: "orange"}.Styles()[".body-alert--info"]["background-color"])
+	assert.Equal(t, "#111111", styles["h1"]["color"])
+	assert.Equal(t, "#111111", styles[".email-masthead_name"]["color"])
+	assert.Equal(t, "#ffffff", styles["body"]["background-color"])
+	assert.Equal(t, "#ffffff", styles[".email-wrapper"]["background-color"])
+	assert.Equal(t, "#aeaeae", styles[".email-footer p"]["color"])
+	assert.Equal(t, "#222222", styles["p"]["color"])
+	assert.Equal(t, "#222222", styles[".data-table td"]["color"])
+	assert.Equal(t, "Georgia, serif", styles["*:not(br):not(tr):not(html)"]["font-family"])
+	assert.Equal(t, "8px", styles[".button"]["border-radius"])
+	assert.Equal(t, "8px", styles[".invite-code-cell"]["border-radius"])
+	assert.Equal(t, "28px", styles[".content-cell"]["padding"])
+	assert.Equal(t, "20px 0", styles[".email-masthead"]["padding"])
+	assert.Equal(t, "16px auto 8px", styles[".body-dictionary"]["margin"])
+	assert.Equal(t, "24px auto", styles[".body-action"]["margin"])
+	assert.Equal(t, "20px", styles[".body-sub"]["padding-top"])
+
+	// Flat is a preset of tokens
+	flat := Flat{}.Styles()
+	assert.Equal(t, "#2c3e50", flat["body"]["background-color"])
+	assert.Equal(t, "#eaeaea", flat[".email-footer p"]["color"], "Footer should be light on dark backgrounds")
+	assert.Equal(t, "#00948d", flat["a"]["color"])
+}
+
+func TestThemeTokens(t *testing.T) {
+	assert.Equal(t, Default{}.Tokens(), themeTokens(ErrorTheme{}))
+	assert.Equal(t, "#00948d", themeTokens(Flat{}).Primary)
+
+	theme, err := ExtendTheme(new(Flat), ThemeExtension{Name: "brand", Tokens: Tokens{Primary: "#ff6600"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	tokens := themeTokens(theme)
+	assert.Equal(t, "#ff6600", tokens.Primary)
+	assert.Equal(t, "#2c3e50", tokens.Background, "Tokens of the base theme should be kept")
+	assert.Equal(t, "#ff6600", theme.Styles()["a"]["color"])
+	assert.Equal(t, "#2c3e50", theme.Styles()["body"]["background-color"])
+
+	html := renderTheme(t, theme, extendEmail).HTML
+	assert.Contains(t, html, `arcsize="0%" strokecolor="#ff6600" fillcolor="#ff6600"`)
+
+	// Styles of the extension win over its tokens
+	theme, err = ExtendTheme(new(Default), ThemeExtension{
+		Name:   "brand",
+		Tokens: Tokens{Primary: "#ff6600"},
+		Styles: StylesDefinition{".button": {"background-color": "#000000"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "#000000", theme.Styles()[".button"]["background-color"])
+	assert.Equal(t, "#ff6600", theme.Styles()["a"]["color"])
+}
+
+func TestIsDark(t *testing.T) {
+	for color, dark := range map[string]bool{
+		"#2c3e50": true,
+		"#000":    true,
+		"#f2f4f6": false,
+		"#FFF":    false,
+		"navy":    false,
+		"#12345":  false,
+		"#zzzzzz": false,
+	} {
+		assert.Equal(t, dark, isDark(color), color)
+	}
+}
+
+func TestTint(t *testing.T) {
+	assert.Equal(t, "#eff3fc", tint("#3869d4", 0.08))
+	assert.Equal(t, "#ffffff", tint("#000", 0))
+	assert.Equal(t, "#000000", tint("#000", 1))
+	assert.Empty(t, tint("navy", 0.08))
+}
+
+func TestDarkMode(t *testing.T) {
+	product := Product{Name: "Hermes", Logo: "https://example-hermes.com/logo.png", LogoDark: "https://example-hermes.com/logo-dark.png"}
+	render := func(h Hermes) string {
+		t.Helper()
+		r, err := New(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := r.Render(context.Background(), extendEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.HTML
+	}
+
+	html := render(Hermes{Product: product})
+	assert.NotContains(t, html, "color-scheme", "Dark mode should be optional")
+	assert.NotContains(t, html, "logo-dark.png")
+
+	html = render(Hermes{Product: product, DarkMode: true})
+	assert.Contains(t, html, `<meta name="color-scheme" content="light dark"/>`)
+	assert.Contains(t, html, `<meta name="supported-color-schemes" content="light dark"/>`)
+	assert.Contains(t, html, "@media (prefers-color-scheme: dark)")
+	assert.Contains(t, html, "body, .email-wrapper { background-color: #111111 !important; }")
+	assert.Contains(t, html, "[data-ogsb] .email-body { background-color: #1e1e1e !important; }")
+	assert.Contains(t, html, "[data-ogsb] .body-alert { background-color: #111111 !important; }")
+	assert.Contains(t, html, "[data-ogsc] p, [data-ogsc] td")
+	assert.Contains(t, html, "a { color: #3869d4 !important; }", "Dark primary color should default to the primary token")
+	assert.Contains(t, html, `src="https://example-hermes.com/logo-dark.png" class="email-logo email-logo-dark" style="max-height:50px;display:none"`)
+	assert.Contains(t, html, `class="email-logo email-logo-light"`)
+
+	theme, err := ExtendTheme(new(Flat), ThemeExtension{Name: "brand", Tokens: Tokens{Dark: DarkPalette{Background: "#000000", Primary: "#33cccc"}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	html = render(Hermes{Theme: theme, Product: Product{Name: "Hermes"}, DarkMode: true})
+	assert.Contains(t, html, "body, .email-wrapper { background-color: #000000 !important; }")
+	assert.Contains(t, html, ".button { background-color: #33cccc !important; }")
+	assert.Contains(t, html, "color: #d4d4d4 !important;", "Default dark palette should complete the theme one")
+	assert.NotContains(t, html, `class="email-logo email-logo-dark"`, "Dark logo is optional")
+}
@@ -0,0 +1,387 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail/smtp"
+)
+
+// ErrClosed is returned when sending with a closed Bulk sender
+var ErrClosed = errors.New("sender is closed")
+
+// BulkConfig is the configuration of a Bulk sender
+type BulkConfig struct {
+	SMTPConfig
+	Connections           int     // Maximum number of connections open at once (default to 2)
+	MessagesPerConnection int     // Messages sent over a connection before it is replaced (default to 100)
+	Rate                  float64 // Maximum number of messages sent per second (unlimited when 0)
+	DomainRate            float64 // Maximum number of messages sent per second to each recipient domain (unlimited when 0)
+}
+
+// Result is the outcome of sending a message to one of its recipients
+type Result struct {
+	MessageID string
+	Recipient string
+	Err       error // Error when the recipient was refused or the message was not sent, nil otherwise
+}
+
+// Bulk sends messages to an SMTP server over a pool of connections, each one
+// reused for several messages, while enforcing sending rates
+type Bulk struct {
+	client  *mail.Client
+	cfg     BulkConfig
+	slots   chan struct{} // one per connection that can be opened
+	idle    chan *pooledConn
+	limiter *limiter
+
+	mu      sync.Mutex
+	closed  bool
+	domains map[string]*limiter
+}
+
+// pooledConn is an SMTP session of a Bulk sender
+type pooledConn struct {
+	c    *smtp.Client
+	sent int
+}
+
+// NewBulk returns a sender delivering messages to the SMTP server of cfg
+func NewBulk(cfg BulkConfig) (*Bulk, error) {
+	client, err := newSMTPClient(cfg.SMTPConfig)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Connections <= 0 {
+		cfg.Connections = 2
+	}
+	if cfg.MessagesPerConnection <= 0 {
+		cfg.MessagesPerConnection = 100
+	}
+	return &Bulk{
+		client:  client,
+		cfg:     cfg,
+		slots:   make(chan struct{}, cfg.Connections),
+		idle:    make(chan *pooledConn, cfg.Connections),
+		limiter: newLimiter(cfg.Rate),
+		domains: map[string]*limiter{},
+	}, nil
+}
+
+// Send delivers the message to all its recipients, like SMTP.Send, but over
+// a pooled connection. The message is not sent when a recipient is refused.
+func (b *Bulk) Send(ctx context.Context, msg *hermes.Message) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+	var err error
+	sendErr := b.with(ctx, msg, func(c *smtp.Client) bool {
+		err = deliver(c, msg)
+		return isProtocolError(err)
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// SendAll sends the messages concurrently, one per connection, and returns
+// the result for each recipient of each message, in order. Unlike Send, a
+// message is still sent to the recipients accepted by the server when others
+// are refused.
+func (b *Bulk) SendAll(ctx context.Context, msgs []*hermes.Message) []Result {
+	results := make([][]Result, len(msgs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(b.cfg.Connections, len(msgs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = b.sendEach(ctx, msgs[i])
+			}
+		}()
+	}
+	for i := range msgs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var all []Result
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+// sendEach sends the message to the recipients accepted by the server
+func (b *Bulk) sendEach(ctx context.Context, msg *hermes.Message) []Result {
+	if msg == nil {
+		return []Result{{Err: ErrNilMessage}}
+	}
+	var results []Result
+	err := b.with(ctx, msg, func(c *smtp.Client) bool {
+		results = deliverEach(c, msg)
+		for _, r := range results {
+			if r.Err != nil && !isProtocolError(r.Err) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		for _, rcpt := range msg.Recipients() {
+			results = append(results, Result{MessageID: msg.MessageID(), Recipient: rcpt, Err: err})
+		}
+	}
+	return results
+}
+
+// with waits for the sending rates to allow the message, then calls send
+// with a pooled connection. The connection is closed when send returns
+// false, e.g. after a network error, or when ctx is done during send, which
+// then reports its own result: ctx is only checked before sending.
+func (b *Bulk) with(ctx context.Context, msg *hermes.Message, send func(c *smtp.Client) bool) error {
+	if err := b.wait(ctx, msg); err != nil {
+		return err
+	}
+	pc, err := b.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		b.release(pc, true)
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = pc.c.Close() })
+	reusable := send(pc.c)
+	pc.sent++
+	b.release(pc, stop() && reusable)
+	return nil
+}
+
+// wait blocks until the global and recipient domain rates allow sending the message
+func (b *Bulk) wait(ctx context.Context, msg *hermes.Message) error {
+	if err := b.limiter.wait(ctx); err != nil {
+		return err
+	}
+	if b.cfg.DomainRate <= 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, rcpt := range msg.Recipients() {
+		domain := recipientDomain(rcpt)
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		b.mu.Lock()
+		l, ok := b.domains[domain]
+		if !ok {
+			l = newLimiter(b.cfg.DomainRate)
+			b.domains[domain] = l
+		}
+		b.mu.Unlock()
+		if err := l.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquire returns an idle connection, or opens a new one when the pool is not full
+func (b *Bulk) acquire(ctx context.Context) (*pooledConn, error) {
+	for {
+		if b.isClosed() {
+			return nil, ErrClosed
+		}
+		select {
+		case pc := <-b.idle:
+			if b.isClosed() {
+				b.release(pc, true)
+				return nil, ErrClosed
+			}
+			if err := pc.c.Noop(); err != nil {
+				// The server closed the idle connection
+				_ = pc.c.Close()
+				<-b.slots
+				continue
+			}
+			return pc, nil
+		case b.slots <- struct{}{}:
+			// The sender may have been closed while waiting
+			if b.isClosed() {
+				<-b.slots
+				return nil, ErrClosed
+			}
+			c, err := b.client.DialToSMTPClientWithContext(ctx)
+			if err != nil {
+				<-b.slots
+				return nil, fmt.Errorf("connecting to SMTP server: %w", err)
+			}
+			return &pooledConn{c: c}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isClosed tells whether the sender is closed
+func (b *Bulk) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// release gives the connection back to the pool, or closes it when it
+// should not be reused
+func (b *Bulk) release(pc *pooledConn, reusable bool) {
+	b.mu.Lock()
+	if reusable && !b.closed && pc.sent < b.cfg.MessagesPerConnection {
+		b.idle <- pc // never blocks, the pool has room for all connections
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+	if reusable {
+		_ = b.client.CloseWithSMTPClient(pc.c)
+	} else {
+		_ = pc.c.Close()
+	}
+	<-b.slots
+}
+
+// Close closes the idle connections. Connections in use are closed once
+// their message is sent, and the messages waiting for a connection fail with
+// ErrClosed.
+func (b *Bulk) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	var errs []error
+	for {
+		select {
+		case pc := <-b.idle:
+			if err := b.client.CloseWithSMTPClient(pc.c); err != nil {
+				errs = append(errs, err)
+			}
+			<-b.slots
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// deliverEach sends the message over an established SMTP session to the
+// recipients accepted by the server, and returns the result for each one
+func deliverEach(c *smtp.Client, msg *hermes.Message) []Result {
+	recipients := msg.Recipients()
+	results := make([]Result, len(recipients))
+	failAll := func(err error) []Result {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+		return results
+	}
+	for i, rcpt := range recipients {
+		results[i] = Result{MessageID: msg.MessageID(), Recipient: rcpt}
+	}
+
+	if err := c.Mail("<" + msg.From() + ">"); err != nil {
+		_ = c.Reset()
+		return failAll(fmt.Errorf("MAIL FROM %s: %w", msg.From(), err))
+	}
+	accepted := 0
+	for i, rcpt := range recipients {
+		if err := c.Rcpt("<" + rcpt + ">"); err != nil {
+			results[i].Err = &RecipientError{Recipient: rcpt, Err: err}
+			if !isProtocolError(err) {
+				return failAll(err)
+			}
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		_ = c.Reset()
+		return results
+	}
+	w, err := c.Data()
+	if err != nil {
+		return failAll(fmt.Errorf("DATA: %w", err))
+	}
+	if _, err = msg.WriteTo(w); err != nil {
+		_ = w.Close()
+		return failAll(fmt.Errorf("writing message: %w", err))
+	}
+	if err = w.Close(); err != nil {
+		return failAll(fmt.Errorf("DATA: %w", err))
+	}
+	return results
+}
+
+// isProtocolError tells whether err is nil or a reply of the SMTP server,
+// after which the session can still be used
+func isProtocolError(err error) bool {
+	var protoErr *textproto.Error
+	return err == nil || errors.As(err, &protoErr)
+}
+
+// recipientDomain returns the lower-cased domain of an address
+func recipientDomain(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
+
+// limiter spaces out events to enforce a rate
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newLimiter returns a limiter allowing rate events per second, or nil when rate is not positive
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next event is allowed. A nil limiter never blocks.
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
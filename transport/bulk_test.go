@@ -0,0 +1,201 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkMessages returns n messages, each one sent to the given recipients
+func bulkMessages(t *testing.T, n int, to ...string) []*hermes.Message {
+	t.Helper()
+	msgs := make([]*hermes.Message, n)
+	for i := range msgs {
+		msg, err := new(hermes.Hermes).BuildMessage(hermes.Envelope{
+			From: "hermes@example.com",
+			To:   to,
+		}, hermes.Email{Subject: fmt.Sprintf("Newsletter %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[i] = msg
+	}
+	return msgs
+}
+
+func TestNewBulk(t *testing.T) {
+	_, err := NewBulk(BulkConfig{SMTPConfig: SMTPConfig{Port: 25}})
+	assert.ErrorIs(t, err, ErrEmptyServerConfig)
+
+	b, err := NewBulk(BulkConfig{SMTPConfig: SMTPConfig{Host: "localhost", Port: 25}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, b.cfg.Connections)
+	assert.Equal(t, 100, b.cfg.MessagesPerConnection)
+}
+
+func TestBulk_ConnectionReuse(t *testing.T) {
+	server := newFakeSMTP(t)
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config(), Connections: 1, MessagesPerConnection: 2})
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, b.Close()) }()
+
+	msgs := bulkMessages(t, 5, "jon@example.com")
+	results := b.SendAll(context.Background(), msgs)
+	if assert.Len(t, results, 5) {
+		for i, r := range results {
+			assert.NoError(t, r.Err)
+			assert.Equal(t, msgs[i].MessageID(), r.MessageID)
+			assert.Equal(t, "jon@example.com", r.Recipient)
+		}
+	}
+	assert.Len(t, server.received(), 5)
+	assert.Equal(t, 3, server.connections(), "Connections should be replaced after 2 messages")
+
+	// Send reuses the idle connection
+	assert.NoError(t, b.Send(context.Background(), msgs[0]))
+	assert.Equal(t, 3, server.connections())
+	assert.Len(t, server.received(), 6)
+
+	assert.NoError(t, b.Close())
+	assert.ErrorIs(t, b.Send(context.Background(), msgs[0]), ErrClosed)
+}
+
+func TestBulk_Results(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.reply = func(cmd, arg string) string {
+		switch {
+		case cmd == "RCPT" && arg == "unknown@example.com":
+			return "550 no such user"
+		case cmd == "RCPT" && arg == "full@example.org":
+			return "452 mailbox full"
+		}
+		return ""
+	}
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config()})
+	assert.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	msgs := bulkMessages(t, 2, "jon@example.com", "unknown@example.com", "full@example.org")
+	results := b.SendAll(context.Background(), msgs)
+	if !assert.Len(t, results, 6) {
+		return
+	}
+	for i := 0; i < 6; i += 3 {
+		assert.NoError(t, results[i].Err)
+		var protoErr *textproto.Error
+		if assert.True(t, errors.As(results[i+1].Err, &protoErr)) {
+			assert.Equal(t, 550, protoErr.Code)
+		}
+		assert.True(t, IsPermanent(results[i+1].Err))
+		assert.ErrorContains(t, results[i+2].Err, "mailbox full")
+		assert.False(t, IsPermanent(results[i+2].Err))
+	}
+	received := server.received()
+	if assert.Len(t, received, 2, "Messages should be sent to the accepted recipients") {
+		assert.Equal(t, []string{"jon@example.com"}, received[0].to)
+	}
+
+	// Send does not send messages with refused recipients
+	assert.ErrorContains(t, b.Send(context.Background(), msgs[0]), "no such user")
+	assert.Len(t, server.received(), 2)
+}
+
+func TestBulk_Rate(t *testing.T) {
+	server := newFakeSMTP(t)
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config(), Connections: 4, Rate: 50})
+	assert.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	start := time.Now()
+	results := b.SendAll(context.Background(), bulkMessages(t, 6, "jon@example.com"))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "6 messages at 50/s should take at least 100ms")
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+	}
+}
+
+func TestBulk_DomainRate(t *testing.T) {
+	server := newFakeSMTP(t)
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config(), Connections: 4, DomainRate: 20})
+	assert.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	start := time.Now()
+	results := b.SendAll(context.Background(), bulkMessages(t, 4, "jon@example.com", "arya@Example.com", "sansa@example.org"))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 150*time.Millisecond, "4 messages to a domain at 20/s should take at least 150ms")
+	assert.Less(t, elapsed, time.Second, "Each domain should be limited separately")
+	assert.Len(t, results, 12)
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+	}
+}
+
+func TestBulk_Canceled(t *testing.T) {
+	server := newFakeSMTP(t)
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config(), Rate: 1})
+	assert.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	results := b.SendAll(ctx, bulkMessages(t, 3, "jon@example.com"))
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[2].Err, context.DeadlineExceeded)
+	assert.Len(t, server.received(), 1)
+}
+
+func TestBulk_ClosedWhileWaiting(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.reply = func(cmd, _ string) string {
+		if cmd == "DATA" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return ""
+	}
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config(), Connections: 1})
+	assert.NoError(t, err)
+
+	msgs := bulkMessages(t, 2, "jon@example.com")
+	errs := make(chan error, 2)
+	go func() { errs <- b.Send(context.Background(), msgs[0]) }()
+	time.Sleep(50 * time.Millisecond)
+	go func() { errs <- b.Send(context.Background(), msgs[1]) }()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, b.Close())
+
+	assert.NoError(t, <-errs, "The message being sent should be delivered")
+	assert.ErrorIs(t, <-errs, ErrClosed, "The message waiting for a connection should not be sent")
+	assert.Equal(t, 1, server.connections())
+	assert.Len(t, server.received(), 1)
+}
+
+func TestBulk_CanceledWhileSending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := newFakeSMTP(t)
+	server.reply = func(cmd, _ string) string {
+		if cmd == "DATA" {
+			cancel()
+			time.Sleep(50 * time.Millisecond)
+		}
+		return ""
+	}
+	b, err := NewBulk(BulkConfig{SMTPConfig: server.config(), Connections: 1})
+	assert.NoError(t, err)
+	defer func() { _ = b.Close() }()
+
+	results := b.SendAll(ctx, bulkMessages(t, 2, "jon@example.com"))
+	if assert.Len(t, results, 2) {
+		assert.NoError(t, results[0].Err, "The message being sent should report its own result")
+		assert.ErrorIs(t, results[1].Err, context.Canceled, "The next message should not be sent")
+	}
+	assert.Len(t, server.received(), 1)
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+// deliveries counts the messages written by this process, to give them unique file names
+var deliveries atomic.Uint64
+
+// Dir writes each message as an .eml file in a directory, e.g. to inspect
+// them during development
+type Dir struct {
+	dir string
+}
+
+// NewDir returns a sender writing messages to dir, creating it if needed
+func NewDir(dir string) (*Dir, error) {
+	if dir == "" {
+		return nil, ErrEmptyDirectory
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &Dir{dir: dir}, nil
+}
+
+// Send writes the message to a new file named after the delivery time. The
+// file appears complete: it is written under a temporary name, then renamed.
+func (d *Dir) Send(ctx context.Context, msg *hermes.Message) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeFile(msg, d.dir, filepath.Join(d.dir, uniqueName()+".eml"))
+}
+
+// Maildir delivers messages to a Maildir, read by most mail clients and IMAP
+// servers: messages are written to its tmp directory, then moved to new.
+type Maildir struct {
+	dir string
+}
+
+// NewMaildir returns a sender delivering messages to the Maildir at dir,
+// creating its tmp, new and cur directories if needed
+func NewMaildir(dir string) (*Maildir, error) {
+	if dir == "" {
+		return nil, ErrEmptyDirectory
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &Maildir{dir: dir}, nil
+}
+
+// Send delivers the message to the new directory of the Maildir
+func (m *Maildir) Send(ctx context.Context, msg *hermes.Message) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeFile(msg, filepath.Join(m.dir, "tmp"), filepath.Join(m.dir, "new", uniqueName()))
+}
+
+// writeFile writes the message in tmpDir, then moves it to name
+func writeFile(msg *hermes.Message, tmpDir, name string) error {
+	f, err := os.CreateTemp(tmpDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = msg.WriteTo(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("writing message: %w", err)
+	}
+	return nil
+}
+
+// uniqueName returns a unique file name following the Maildir conventions,
+// i.e. <seconds>.M<microseconds>P<pid>Q<count>.<host>
+func uniqueName() string {
+	now := time.Now()
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), deliveries.Add(1), host)
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+// Recorder keeps the messages sent in memory, e.g. to check them in tests.
+// The zero value is ready to use.
+type Recorder struct {
+	// Fail, when set, returns the error reported when sending msg.
+	// Messages are only recorded when it returns nil.
+	Fail func(msg *hermes.Message) error
+
+	mu       sync.Mutex
+	messages []*hermes.Message
+}
+
+// Send records the message
+func (r *Recorder) Send(ctx context.Context, msg *hermes.Message) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.Fail != nil {
+		if err := r.Fail(msg); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+// Messages returns the messages recorded, in the order they were sent
+func (r *Recorder) Messages() []*hermes.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.messages)
+}
+
+// Reset forgets the messages recorded
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = nil
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+// DefaultSendmailPath is the usual location of the sendmail binary
+const DefaultSendmailPath = "/usr/sbin/sendmail"
+
+// Sendmail hands messages to a local sendmail-compatible binary (sendmail,
+// postfix, exim, msmtp...)
+type Sendmail struct {
+	path string
+	args []string
+}
+
+// NewSendmail returns a sender running the binary at path, with the extra
+// arguments given before the sendmail flags set by hermes
+func NewSendmail(path string, args ...string) (*Sendmail, error) {
+	if path == "" {
+		return nil, ErrEmptySendmailPath
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("sendmail: %w", err)
+	}
+	return &Sendmail{path: resolved, args: args}, nil
+}
+
+// Send runs sendmail with the message on its standard input. The message uses
+// local line endings, and sendmail is killed when ctx is canceled.
+func (s *Sendmail) Send(ctx context.Context, msg *hermes.Message) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+	args := append(s.args[:len(s.args):len(s.args)], "-i", "-f", msg.From(), "--")
+	args = append(args, msg.Recipients()...)
+
+	cmd := exec.CommandContext(ctx, s.path, args...)
+	cmd.Stdin = bytes.NewReader(bytes.ReplaceAll(msg.Bytes(), []byte("\r\n"), []byte("\n")))
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("sendmail: %w: %s", err, out)
+		}
+		return fmt.Errorf("sendmail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMessage is a message received by a fakeSMTP server
+type fakeMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP is a minimal SMTP server recording the messages it receives
+type fakeSMTP struct {
+	ln net.Listener
+	// reply, when set, returns the reply to a command instead of the default one
+	// (e.g. "550 no such user"), or an empty string to keep the default reply
+	reply func(cmd, arg string) string
+
+	mu       sync.Mutex
+	conns    int
+	messages []fakeMessage
+	wg       sync.WaitGroup
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *fakeSMTP) config() SMTPConfig {
+	return SMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      s.ln.Addr().(*net.TCPAddr).Port,
+		TLSPolicy: NoTLS,
+	}
+}
+
+func (s *fakeSMTP) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *fakeSMTP) received() []fakeMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 fake ESMTP")
+
+	var current fakeMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+		if cmd == "MAIL" || cmd == "RCPT" {
+			_, arg, _ = strings.Cut(arg, ":")
+			arg, _, _ = strings.Cut(strings.Trim(arg, "<"), ">")
+		}
+		reply := ""
+		if s.reply != nil {
+			reply = s.reply(cmd, arg)
+		}
+		if reply != "" {
+			_ = tp.PrintfLine("%s", reply)
+			if cmd == "DATA" && strings.HasPrefix(reply, "354") {
+				_, _ = tp.ReadDotBytes()
+			}
+			continue
+		}
+
+		switch cmd {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250 fake")
+		case "MAIL":
+			current = fakeMessage{from: arg}
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.to = append(current.to, arg)
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := readDot(tp.R)
+			if err != nil {
+				return
+			}
+			current.data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = fakeMessage{}
+			_ = tp.PrintfLine("250 queued")
+		case "RSET":
+			current = fakeMessage{}
+			_ = tp.PrintfLine("250 OK")
+		case "NOOP":
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// readDot reads DATA content until the terminating dot, keeping CRLF line endings
+func readDot(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return b.String(), nil
+		}
+		b.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail/smtp"
+)
+
+// TLSPolicy tells how an SMTP connection is encrypted with STARTTLS
+type TLSPolicy int
+
+const (
+	// TLSMandatory refuses to send messages when the server does not support STARTTLS (default)
+	TLSMandatory TLSPolicy = iota
+	// TLSOpportunistic uses STARTTLS when the server supports it
+	TLSOpportunistic
+	// NoTLS never uses STARTTLS, e.g. for local relays
+	NoTLS
+)
+
+// SMTPConfig is the configuration of an SMTP sender
+type SMTPConfig struct {
+	Host      string
+	Port      int
+	Username  string            // User to authenticate with (no authentication when empty)
+	Password  string            // Password of the user
+	Auth      mail.SMTPAuthType // Authentication mechanism (default to mail.SMTPAuthAutoDiscover)
+	TLSPolicy TLSPolicy         // STARTTLS policy, ignored with SSL
+	SSL       bool              // Use implicit TLS, usually on port 465
+	HELO      string            // Host name sent with HELO/EHLO (default to localhost)
+	Timeout   time.Duration     // Timeout of the connection to the server (default to 15 seconds)
+}
+
+// SMTP sends messages to an SMTP server, opening a connection for each message
+type SMTP struct {
+	client *mail.Client
+}
+
+// NewSMTP returns a sender delivering messages to the SMTP server of cfg
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	client, err := newSMTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SMTP{client: client}, nil
+}
+
+// newSMTPClient validates cfg and returns a go-mail client for it
+func newSMTPClient(cfg SMTPConfig) (*mail.Client, error) {
+	if cfg.Host == "" {
+		return nil, ErrEmptyServerConfig
+	}
+	if cfg.Port == 0 {
+		return nil, ErrEmptyPort
+	}
+	if cfg.Username == "" && cfg.Password != "" {
+		return nil, ErrEmptyUser
+	}
+
+	opts := []mail.Option{mail.WithPort(cfg.Port)}
+	switch {
+	case cfg.SSL:
+		opts = append(opts, mail.WithSSL())
+	case cfg.TLSPolicy == TLSOpportunistic:
+		opts = append(opts, mail.WithTLSPolicy(mail.TLSOpportunistic))
+	case cfg.TLSPolicy == NoTLS:
+		opts = append(opts, mail.WithTLSPolicy(mail.NoTLS))
+	default:
+		opts = append(opts, mail.WithTLSPolicy(mail.TLSMandatory))
+	}
+	if cfg.Username != "" {
+		auth := cfg.Auth
+		if auth == "" {
+			auth = mail.SMTPAuthAutoDiscover
+		}
+		opts = append(opts,
+			mail.WithSMTPAuth(auth),
+			mail.WithUsername(cfg.Username),
+			mail.WithPassword(cfg.Password),
+		)
+	}
+	if cfg.HELO != "" {
+		opts = append(opts, mail.WithHELO(cfg.HELO))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, mail.WithTimeout(cfg.Timeout))
+	}
+	return mail.NewClient(cfg.Host, opts...)
+}
+
+// Send delivers the message over a new SMTP connection. The connection is
+// closed when ctx is canceled before the server accepts the message.
+func (s *SMTP) Send(ctx context.Context, msg *hermes.Message) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+	c, err := s.client.DialToSMTPClientWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("connecting to SMTP server: %w", err)
+	}
+	defer func() { _ = s.client.CloseWithSMTPClient(c) }()
+
+	stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+	defer stop()
+	err = deliver(c, msg)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// RecipientError is the refusal of a recipient by the SMTP server
+type RecipientError struct {
+	Recipient string
+	Err       error // Reply of the server, a *textproto.Error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("RCPT TO %s: %v", e.Recipient, e.Err)
+}
+
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+// deliver sends the message over an established SMTP session. Recipients
+// refused by the server are all reported, as RecipientError, and the
+// transaction is reset.
+func deliver(c *smtp.Client, msg *hermes.Message) error {
+	if err := c.Mail("<" + msg.From() + ">"); err != nil {
+		_ = c.Reset()
+		return fmt.Errorf("MAIL FROM %s: %w", msg.From(), err)
+	}
+	var refused []error
+	for _, rcpt := range msg.Recipients() {
+		if err := c.Rcpt("<" + rcpt + ">"); err != nil {
+			refused = append(refused, &RecipientError{Recipient: rcpt, Err: err})
+		}
+	}
+	if len(refused) > 0 {
+		_ = c.Reset()
+		return errors.Join(refused...)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if _, err = msg.WriteTo(w); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	return nil
+}
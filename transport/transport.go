@@ -0,0 +1,76 @@
+// Package transport delivers the messages built by hermes, over SMTP, through
+// a local sendmail binary, to a directory or to memory.
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"os/exec"
+
+	"github.com/go-hermes/hermes/v2"
+)
+
+var (
+	// ErrNilMessage is returned when sending a nil message
+	ErrNilMessage = errors.New("message is nil")
+	// ErrEmptyServerConfig is returned when creating an SMTP sender without host
+	ErrEmptyServerConfig = errors.New("SMTP server config is empty")
+	// ErrEmptyPort is returned when creating an SMTP sender without port
+	ErrEmptyPort = errors.New("SMTP port config is empty")
+	// ErrEmptyUser is returned when creating an SMTP sender with a password but without user
+	ErrEmptyUser = errors.New("SMTP user is empty")
+	// ErrEmptySendmailPath is returned when creating a sendmail sender without binary
+	ErrEmptySendmailPath = errors.New("sendmail path is empty")
+	// ErrEmptyDirectory is returned when creating a file sender without directory
+	ErrEmptyDirectory = errors.New("directory is empty")
+)
+
+// Sender delivers messages. Implementations are safe for concurrent use.
+type Sender interface {
+	// Send delivers the message to all its recipients
+	Send(ctx context.Context, msg *hermes.Message) error
+}
+
+// SenderFunc is a function used as a Sender
+type SenderFunc func(ctx context.Context, msg *hermes.Message) error
+
+// Send calls f(ctx, msg)
+func (f SenderFunc) Send(ctx context.Context, msg *hermes.Message) error {
+	return f(ctx, msg)
+}
+
+// exTempFail is the exit status of sendmail when delivery should be retried later (sysexits.h)
+const exTempFail = 75
+
+// IsPermanent tells whether sending failed for good, so that retrying is
+// pointless: SMTP 5xx replies, sendmail exit statuses other than EX_TEMPFAIL
+// and nil messages. Other failures, like SMTP 4xx replies or network errors,
+// are temporary. When several recipients are refused, the failure is
+// permanent only if all of them are.
+func IsPermanent(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrNilMessage) {
+		return true
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, e := range errs {
+			if !IsPermanent(e) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode() > 0 && exitErr.ExitCode() != exTempFail
+	}
+	return false
+}
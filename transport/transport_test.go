@@ -0,0 +1,239 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-hermes/hermes/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMessage(t *testing.T) *hermes.Message {
+	t.Helper()
+	h := hermes.Hermes{Product: hermes.Product{Name: "Hermes", Link: "https://example-hermes.com/"}}
+	msg, err := h.BuildMessage(hermes.Envelope{
+		From: "Hermes <hermes@example.com>",
+		To:   []string{"Jon Snow <jon@example.com>"},
+		Bcc:  []string{"audit@example.org"},
+	}, hermes.Email{
+		Subject: "Welcome to Hermes",
+		Body: hermes.Body{
+			Name:   "Jon Snow",
+			Intros: []string{"Welcome to Hermes! We're very excited to have you on board."},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestNewSMTP(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SMTPConfig
+		err  error
+	}{
+		{"empty host", SMTPConfig{Port: 587}, ErrEmptyServerConfig},
+		{"empty port", SMTPConfig{Host: "smtp.example.com"}, ErrEmptyPort},
+		{"password without user", SMTPConfig{Host: "smtp.example.com", Port: 587, Password: "secret"}, ErrEmptyUser},
+		{"valid", SMTPConfig{Host: "smtp.example.com", Port: 587, Username: "jon", Password: "secret"}, nil},
+		{"valid without auth", SMTPConfig{Host: "localhost", Port: 25, TLSPolicy: NoTLS}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewSMTP(test.cfg)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				assert.Nil(t, s)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, s)
+		})
+	}
+}
+
+func TestSMTP_Send(t *testing.T) {
+	server := newFakeSMTP(t)
+	s, err := NewSMTP(server.config())
+	assert.NoError(t, err)
+
+	msg := testMessage(t)
+	assert.NoError(t, s.Send(context.Background(), msg))
+	assert.ErrorIs(t, s.Send(context.Background(), nil), ErrNilMessage)
+
+	received := server.received()
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "hermes@example.com", received[0].from)
+		assert.Equal(t, []string{"jon@example.com", "audit@example.org"}, received[0].to)
+		assert.Equal(t, string(msg.Bytes()), received[0].data)
+	}
+}
+
+func TestSMTP_SendRefused(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.reply = func(cmd, arg string) string {
+		if cmd == "RCPT" && arg == "audit@example.org" {
+			return "550 no such user"
+		}
+		return ""
+	}
+	s, err := NewSMTP(server.config())
+	assert.NoError(t, err)
+
+	err = s.Send(context.Background(), testMessage(t))
+	assert.ErrorContains(t, err, "audit@example.org")
+	var protoErr *textproto.Error
+	if assert.True(t, errors.As(err, &protoErr)) {
+		assert.Equal(t, 550, protoErr.Code)
+	}
+	assert.Empty(t, server.received(), "Message should not be sent when a recipient is refused")
+}
+
+func TestSMTP_SendCanceled(t *testing.T) {
+	server := newFakeSMTP(t)
+	s, err := NewSMTP(server.config())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, s.Send(ctx, testMessage(t)))
+	assert.Empty(t, server.received())
+}
+
+func TestSendmail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sendmail is not available on windows")
+	}
+	_, err := NewSendmail("")
+	assert.ErrorIs(t, err, ErrEmptySendmailPath)
+	_, err = NewSendmail(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sendmail")
+	err = os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > \""+dir+"/args\"\ncat > \""+dir+"/stdin\"\n"), 0755)
+	assert.NoError(t, err)
+
+	s, err := NewSendmail(script, "-oi")
+	assert.NoError(t, err)
+	msg := testMessage(t)
+	assert.NoError(t, s.Send(context.Background(), msg))
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	assert.NoError(t, err)
+	assert.Equal(t, "-oi -i -f hermes@example.com -- jon@example.com audit@example.org\n", string(args))
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stdin), "\r\n")
+	assert.Equal(t, strings.ReplaceAll(string(msg.Bytes()), "\r\n", "\n"), string(stdin))
+
+	failing := filepath.Join(dir, "failing")
+	err = os.WriteFile(failing, []byte("#!/bin/sh\necho 'recipient refused' >&2\nexit 75\n"), 0755)
+	assert.NoError(t, err)
+	s, err = NewSendmail(failing)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, s.Send(context.Background(), msg), "recipient refused")
+}
+
+func TestDir(t *testing.T) {
+	_, err := NewDir("")
+	assert.ErrorIs(t, err, ErrEmptyDirectory)
+
+	dir := filepath.Join(t.TempDir(), "outbox")
+	d, err := NewDir(dir)
+	assert.NoError(t, err)
+	msg := testMessage(t)
+	assert.NoError(t, d.Send(context.Background(), msg))
+	assert.NoError(t, d.Send(context.Background(), msg))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2, "Each message should be written to its own file") {
+		for _, f := range files {
+			assert.Equal(t, ".eml", filepath.Ext(f))
+			content, err := os.ReadFile(f)
+			assert.NoError(t, err)
+			assert.Equal(t, msg.Bytes(), content)
+		}
+	}
+}
+
+func TestMaildir(t *testing.T) {
+	_, err := NewMaildir("")
+	assert.ErrorIs(t, err, ErrEmptyDirectory)
+
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	m, err := NewMaildir(dir)
+	assert.NoError(t, err)
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		assert.DirExists(t, filepath.Join(dir, sub))
+	}
+	msg := testMessage(t)
+	assert.NoError(t, m.Send(context.Background(), msg))
+
+	tmp, _ := os.ReadDir(filepath.Join(dir, "tmp"))
+	assert.Empty(t, tmp, "Messages should be moved out of tmp")
+	delivered, _ := os.ReadDir(filepath.Join(dir, "new"))
+	if assert.Len(t, delivered, 1) {
+		content, err := os.ReadFile(filepath.Join(dir, "new", delivered[0].Name()))
+		assert.NoError(t, err)
+		assert.Equal(t, msg.Bytes(), content)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	msg := testMessage(t)
+	assert.NoError(t, r.Send(context.Background(), msg))
+	assert.Equal(t, []*hermes.Message{msg}, r.Messages())
+
+	errRefused := errors.New("refused")
+	r.Fail = func(*hermes.Message) error { return errRefused }
+	assert.ErrorIs(t, r.Send(context.Background(), msg), errRefused)
+	assert.Len(t, r.Messages(), 1)
+
+	r.Reset()
+	assert.Empty(t, r.Messages())
+}
+
+func TestIsPermanent(t *testing.T) {
+	temporary := &textproto.Error{Code: 451, Msg: "try again later"}
+	permanent := &textproto.Error{Code: 550, Msg: "no such user"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"4xx", fmt.Errorf("RCPT TO jon@example.com: %w", temporary), false},
+		{"5xx", fmt.Errorf("RCPT TO jon@example.com: %w", permanent), true},
+		{"all recipients refused", errors.Join(permanent, permanent), true},
+		{"some recipients deferred", errors.Join(permanent, temporary), false},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, false},
+		{"canceled", context.Canceled, false},
+		{"nil message", ErrNilMessage, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, IsPermanent(test.err))
+		})
+	}
+
+	if runtime.GOOS != "windows" {
+		for status, want := range map[string]bool{"75": false, "69": true} {
+			err := exec.Command("/bin/sh", "-c", "exit "+status).Run()
+			assert.Equal(t, want, IsPermanent(fmt.Errorf("sendmail: %w", err)), "Exit status %s", status)
+		}
+	}
+}